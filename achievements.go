@@ -0,0 +1,259 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+)
+
+// toastDuration is how long an unlock stays on screen
+const toastDuration = 4 * time.Second
+
+// armyCycleID is the 4 Army Cycle's ID in the shipped patterns file and the
+// defaults, the hash of 1aLC2aLC3aLC4aLC. Renaming it or fixing its keys
+// keeps the ID.
+const armyCycleID = "dfdd2fc5d2e70529"
+
+// achievement is a milestone unlocked once its progress reaches its goal
+type achievement struct {
+	id    string // key in the stats file; never change it
+	icon  string
+	name  string
+	about string
+
+	progress func(s *AllStats) (have, need int)
+}
+
+var achievements = []achievement{
+	{"first_perfect", "🎯", "First Blood", "Finish a pattern without a reset", perfectRuns(1)},
+	{"perfect_100", "💯", "Centurion", "100 perfect runs", perfectRuns(100)},
+	{"perfect_1000", "🏅", "Muscle Memory", "1000 perfect runs", perfectRuns(1000)},
+	{"streak_10", "🔗", "Locked In", "10 perfect runs in a row on one pattern", bestStreak(10)},
+	{"streak_50", "⛓", "Unbreakable", "50 perfect runs in a row on one pattern", bestStreak(50)},
+	{"cycle_sub_second", "⚡", "Sub-Second Cycle", "4 Army Cycle in under a second", fastest(armyCycleID, time.Second)},
+	{"sessions_10", "📚", "Regular", "Play 10 sessions", sessions(10)},
+	{"sessions_100", "🏛", "Veteran", "Play 100 sessions", sessions(100)},
+	{"train_1h", "⏱", "First Hour", "Train for an hour in all", trainTime(time.Hour)},
+	{"train_10h", "⌛", "Ten Hours", "Train for ten hours in all", trainTime(10 * time.Hour)},
+	{"practice_7", "📅", "Week In, Week Out", "Practise 7 days in a row", practiceStreak(7)},
+	{"daily_7", "🔥", "Daily Devotion", "Complete the daily challenge 7 days in a row", dailyStreak(7)},
+	{"metronome_160", "♩", "Allegro", "A clean metronome run at 160 BPM", topBPM(160)},
+	{"recall_25", "🧠", "Total Recall", "25 perfect memory mode runs", recallRuns(25)},
+	{"adaptive_top", "📈", "Top of the Ladder", "Take a pattern to the top adaptive level", adaptiveTop},
+}
+
+func perfectRuns(need int) func(*AllStats) (int, int) {
+	return func(s *AllStats) (int, int) {
+		have := 0
+		for _, ps := range s.PatternStats {
+			have += ps.PerfectCount
+		}
+		return have, need
+	}
+}
+
+func bestStreak(need int) func(*AllStats) (int, int) {
+	return func(s *AllStats) (int, int) {
+		have := 0
+		for _, ps := range s.PatternStats {
+			have = max(have, ps.BestStreak)
+		}
+		return have, need
+	}
+}
+
+// fastest is met by a best time under the limit on the pattern with the
+// given ID
+func fastest(id string, limit time.Duration) func(*AllStats) (int, int) {
+	return func(s *AllStats) (int, int) {
+		if ps, ok := s.PatternStats[id]; ok && ps.BestTime > 0 && ps.BestTime < limit {
+			return 1, 1
+		}
+		return 0, 1
+	}
+}
+
+func sessions(need int) func(*AllStats) (int, int) {
+	return func(s *AllStats) (int, int) {
+		return s.TotalSessions, need
+	}
+}
+
+func trainTime(need time.Duration) func(*AllStats) (int, int) {
+	return func(s *AllStats) (int, int) {
+		return int(s.TotalTrainTime / time.Minute), int(need / time.Minute)
+	}
+}
+
+func practiceStreak(need int) func(*AllStats) (int, int) {
+	return func(s *AllStats) (int, int) {
+		_, best := s.practiceStreaks("", time.Now())
+		return best, need
+	}
+}
+
+func dailyStreak(need int) func(*AllStats) (int, int) {
+	return func(s *AllStats) (int, int) {
+		have := 0
+		for _, ds := range s.Daily {
+			have = max(have, ds.BestStreak)
+		}
+		return have, need
+	}
+}
+
+func topBPM(need int) func(*AllStats) (int, int) {
+	return func(s *AllStats) (int, int) {
+		have := 0
+		for _, ps := range s.PatternStats {
+			if ps.Rhythm != nil {
+				have = max(have, ps.Rhythm.TopBPM)
+			}
+		}
+		return have, need
+	}
+}
+
+func recallRuns(need int) func(*AllStats) (int, int) {
+	return func(s *AllStats) (int, int) {
+		have := 0
+		for _, ps := range s.PatternStats {
+			if ps.Recall != nil {
+				have += ps.Recall.PerfectCount
+			}
+		}
+		return have, need
+	}
+}
+
+func adaptiveTop(s *AllStats) (int, int) {
+	have := 0
+	for _, ps := range s.PatternStats {
+		if ps.Adaptive != nil {
+			have = max(have, ps.Adaptive.TopLevel)
+		}
+	}
+	return have, len(adaptiveLevels) - 1
+}
+
+// unlockAchievements dates the achievements newly reached and returns them
+func (s *AllStats) unlockAchievements(now time.Time) []achievement {
+	var unlocked []achievement
+	for _, a := range achievements {
+		if _, ok := s.Achievements[a.id]; ok {
+			continue
+		}
+		if have, need := a.progress(s); have >= need {
+			if s.Achievements == nil {
+				s.Achievements = make(map[string]time.Time)
+			}
+			s.Achievements[a.id] = now
+			unlocked = append(unlocked, a)
+		}
+	}
+	return unlocked
+}
+
+// checkAchievements unlocks whatever the latest result earned and
+// announces it
+func (app *App) checkAchievements() {
+	// A replay's stats are made up for the viewer
+	if app.playback {
+		return
+	}
+	unlocked := app.stats.unlockAchievements(time.Now())
+	if len(unlocked) == 0 {
+		return
+	}
+	app.stats.save()
+
+	text := "🏆 Unlocked:"
+	for i, a := range unlocked {
+		if i > 0 {
+			text += " •"
+		}
+		text += fmt.Sprintf(" %s %s", a.icon, a.name)
+	}
+	app.showToast(text)
+}
+
+// newToast builds the overlay toasts appear in, along the top of the window
+func (app *App) newToast() fyne.CanvasObject {
+	app.toastText = canvas.NewText("", app.palette.Best)
+	app.toastText.TextSize = 18
+	app.toastText.TextStyle = fyne.TextStyle{Bold: true}
+
+	background := canvas.NewRectangle(app.palette.Toast)
+	background.CornerRadius = 8
+	app.toastBox = container.NewStack(background, container.NewPadded(app.toastText))
+	app.toastBox.Hide()
+	return container.NewVBox(container.NewCenter(app.toastBox))
+}
+
+// showToast shows a note for a few seconds; a newer one replaces it
+func (app *App) showToast(text string) {
+	app.toastText.Text = text
+	app.toastText.Refresh()
+	app.toastBox.Show()
+
+	app.toastShown++
+	shown := app.toastShown
+	go func() {
+		time.Sleep(toastDuration)
+		fyne.Do(func() {
+			if app.toastShown == shown {
+				app.toastBox.Hide()
+			}
+		})
+	}()
+}
+
+// openAchievements shows the gallery of achievements, unlocked or not
+func (app *App) openAchievements() {
+	if app.gallery != nil {
+		app.gallery.RequestFocus()
+		return
+	}
+
+	rows := container.NewVBox()
+	unlocked := 0
+	for _, a := range achievements {
+		have, need := a.progress(app.stats)
+		at, ok := app.stats.Achievements[a.id]
+
+		icon := canvas.NewText("🔒", app.palette.Text)
+		var state fyne.CanvasObject
+		switch {
+		case ok:
+			unlocked++
+			icon.Text = a.icon
+			state = widget.NewLabel(at.Format("2 Jan 2006"))
+		case need > 1:
+			bar := widget.NewProgressBar()
+			bar.SetValue(float64(min(have, need)) / float64(need))
+			state = bar
+		default:
+			state = widget.NewLabel("Locked")
+		}
+		icon.TextSize = 28
+
+		name := widget.NewLabelWithStyle(a.name, fyne.TextAlignLeading, fyne.TextStyle{Bold: true})
+		rows.Add(container.NewBorder(nil, nil,
+			container.NewCenter(icon),
+			container.NewCenter(container.NewGridWrap(fyne.NewSize(140, 36), state)),
+			container.NewVBox(name, widget.NewLabel(a.about)),
+		))
+	}
+
+	header := widget.NewLabelWithStyle(fmt.Sprintf("%d of %d unlocked", unlocked, len(achievements)), fyne.TextAlignCenter, fyne.TextStyle{Bold: true})
+	w := fyne.CurrentApp().NewWindow("🏆 Achievements")
+	w.SetContent(container.NewBorder(header, nil, nil, nil, container.NewVScroll(rows)))
+	w.SetOnClosed(func() { app.gallery = nil })
+	w.Resize(fyne.NewSize(560, 520))
+	app.gallery = w
+	w.Show()
+}
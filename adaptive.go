@@ -0,0 +1,217 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// adaptiveWindow is how many recent runs decide a pattern's adaptive level:
+// all but one of them good moves it up, half or fewer moves it down
+const adaptiveWindow = 5
+
+// adaptiveLevel is one rung of the adaptive ladder
+type adaptiveLevel struct {
+	target    float64 // time target as a multiple of the best time; 0 for none
+	extend    int     // groups added to a cycle like 1a2a3a
+	hideAfter int     // tokens after which the target is hidden; 0 keeps it
+}
+
+var adaptiveLevels = []adaptiveLevel{
+	{},
+	{target: 1.3},
+	{target: 1.15},
+	{target: 1.15, extend: 1},
+	{target: 1.15, extend: 1, hideAfter: 3},
+	{target: 1.05, extend: 2, hideAfter: 3},
+}
+
+// AdaptiveStats is a pattern's place on the adaptive ladder
+type AdaptiveStats struct {
+	Level    int    `json:"level"`
+	TopLevel int    `json:"top_level"`
+	Recent   []bool `json:"recent"` // runs at this level, newest last; true if perfect and on target
+}
+
+// adaptiveRun is the adaptive version of the pattern being played
+type adaptiveRun struct {
+	base   Pattern // the pattern as queued
+	level  int
+	target time.Duration // 0 without a time target
+}
+
+func (r *adaptiveRun) rung() adaptiveLevel {
+	return adaptiveLevels[r.level]
+}
+
+func (s *AllStats) adaptiveLevel(p Pattern) int {
+	if ps, ok := s.PatternStats[p.key()]; ok && ps.Adaptive != nil {
+		return min(max(ps.Adaptive.Level, 0), len(adaptiveLevels)-1)
+	}
+	return 0
+}
+
+func (s *AllStats) bestTime(p Pattern) time.Duration {
+	if ps, ok := s.PatternStats[p.key()]; ok {
+		return ps.BestTime
+	}
+	return 0
+}
+
+// adaptPattern swaps the queued pattern for its version at the pattern's
+// level. A longer variant is a pattern of its own, with its own stats.
+func (app *App) adaptPattern() {
+	base := app.currentPattern
+	run := &adaptiveRun{base: base, level: app.stats.adaptiveLevel(base)}
+	rung := run.rung()
+
+	if rung.extend > 0 {
+		if keys, ok := extendCycle(base.Pattern, rung.extend); ok {
+			app.currentPattern = Pattern{Name: fmt.Sprintf("%s +%d", base.Name, rung.extend), Pattern: keys}
+		}
+	}
+
+	if rung.target > 0 {
+		best := app.stats.bestTime(app.currentPattern)
+		// A new variant is held to the base pattern's pace
+		if best == 0 && app.currentPattern.Pattern != base.Pattern {
+			best = app.stats.bestTime(base) * time.Duration(len(splitTokens(app.currentPattern.Pattern))) / time.Duration(len(splitTokens(base.Pattern)))
+		}
+		run.target = time.Duration(float64(best) * rung.target)
+	}
+	app.adaptive = run
+}
+
+// adaptiveNote describes the level for the best time line
+func (r *adaptiveRun) note() string {
+	text := fmt.Sprintf(" • 📈 Level %d", r.level)
+	if r.target > 0 {
+		text += fmt.Sprintf(" • Target %.2fs", r.target.Seconds())
+	}
+	return text
+}
+
+// finishAdaptive scores a run against its level and moves the level, and
+// returns a note for the status line
+func (app *App) finishAdaptive(elapsed time.Duration) string {
+	run := app.adaptive
+	ps := app.stats.getPatternStats(run.base)
+	if ps.Adaptive == nil {
+		ps.Adaptive = &AdaptiveStats{}
+	}
+	as := ps.Adaptive
+
+	good := app.perfectRun() && (run.target == 0 || elapsed <= run.target)
+	as.Recent = append(as.Recent, good)
+	if len(as.Recent) > adaptiveWindow {
+		as.Recent = as.Recent[len(as.Recent)-adaptiveWindow:]
+	}
+	hits := 0
+	for _, ok := range as.Recent {
+		if ok {
+			hits++
+		}
+	}
+
+	note := ""
+	if !good && app.perfectRun() {
+		note = " • over target"
+	}
+	if len(as.Recent) < adaptiveWindow {
+		return note
+	}
+	switch {
+	case hits >= adaptiveWindow-1 && as.Level < len(adaptiveLevels)-1:
+		as.Level++
+		as.TopLevel = max(as.TopLevel, as.Level)
+		as.Recent = nil
+		return note + fmt.Sprintf(" • ⬆ Level %d", as.Level)
+	case hits*2 <= adaptiveWindow && as.Level > 0:
+		as.Level--
+		as.Recent = nil
+		return note + fmt.Sprintf(" • ⬇ Level %d", as.Level)
+	}
+	return note
+}
+
+// targetHidden reports whether the adaptive level or the end of a memory
+// mode flash hides the target by now
+func (app *App) targetHidden() bool {
+	if app.memory != nil {
+		return app.memory.hidden
+	}
+	if app.adaptive == nil {
+		return false
+	}
+	hideAfter := app.adaptive.rung().hideAfter
+	return hideAfter > 0 && len(app.inputBuffer) >= hideAfter
+}
+
+// showTarget draws the target, hiding the keys not yet typed once the
+// adaptive level or memory mode says so
+func (app *App) showTarget() {
+	text := formatForDisplay(app.currentPattern.Pattern)
+	if app.targetHidden() {
+		text = strings.TrimSpace(formatForDisplay(strings.Join(app.inputBuffer, "")) + " · · ·")
+	}
+	if app.targetDisplay.Text != text {
+		app.targetDisplay.Text = text
+		app.targetDisplay.Refresh()
+	}
+}
+
+// extendCycle lengthens a cycle like 1a2a3a by n more groups, 1a2a3a4a
+// for n = 1, carrying the group keys on. It reports false for patterns
+// that aren't cycles or would run past the last group key.
+func extendCycle(pattern string, n int) (string, bool) {
+	tokens := splitTokens(pattern)
+	if len(tokens) == 0 || !startsGroup(tokens[0]) {
+		return "", false
+	}
+	var groups [][]string
+	for i, token := range tokens {
+		if i == 0 || startsGroup(token) {
+			groups = append(groups, nil)
+		}
+		groups[len(groups)-1] = append(groups[len(groups)-1], token)
+	}
+	if len(groups) < 2 {
+		return "", false
+	}
+
+	tail := strings.Join(groups[0][1:], "")
+	for i := 1; i < len(groups); i++ {
+		if strings.Join(groups[i][1:], "") != tail || groups[i][0] != nextGroupKey(groups[i-1][0]) {
+			return "", false
+		}
+	}
+
+	key := groups[len(groups)-1][0]
+	for range n {
+		if key = nextGroupKey(key); key == "" {
+			return "", false
+		}
+		pattern += key + tail
+	}
+	return pattern, true
+}
+
+// nextGroupKey follows a group key on: 3 to 4, 9 to 0, DT3 to DT4, F2 to
+// F3. It returns "" past the last one.
+func nextGroupKey(key string) string {
+	prefix := strings.TrimRight(key, "0123456789")
+	n, err := strconv.Atoi(key[len(prefix):])
+	if err != nil {
+		return ""
+	}
+	switch {
+	case prefix == "F" && n < 12:
+		return fmt.Sprintf("F%d", n+1)
+	case prefix == "F" || n == 0:
+		return ""
+	case n == 9:
+		return prefix + "0"
+	}
+	return prefix + strconv.Itoa(n+1)
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"time"
+
+	"github.com/ebitengine/oto/v3"
+)
+
+const audioSampleRate = 44100
+
+// Sound identifies one feedback cue
+type Sound int
+
+const (
+	soundAccept Sound = iota
+	soundMistake
+	soundComplete
+	soundNewBest
+	soundSessionComplete
+	soundTick
+)
+
+// tone is one step of a procedurally generated cue; a zero frequency is a rest
+type tone struct {
+	freq float64
+	dur  time.Duration
+}
+
+// soundTones describes every cue as a short melody
+var soundTones = map[Sound][]tone{
+	soundAccept:  {{1200, 25 * time.Millisecond}},
+	soundMistake: {{220, 90 * time.Millisecond}, {165, 140 * time.Millisecond}},
+	soundComplete: {
+		{660, 70 * time.Millisecond},
+		{880, 110 * time.Millisecond},
+	},
+	soundNewBest: {
+		{660, 70 * time.Millisecond},
+		{880, 70 * time.Millisecond},
+		{1320, 160 * time.Millisecond},
+	},
+	soundSessionComplete: {
+		{523, 120 * time.Millisecond},
+		{659, 120 * time.Millisecond},
+		{784, 120 * time.Millisecond},
+		{0, 40 * time.Millisecond},
+		{1047, 300 * time.Millisecond},
+	},
+	soundTick: {{2000, 12 * time.Millisecond}},
+}
+
+// Audio plays feedback cues. Without an audio device it stays silent.
+type Audio struct {
+	ctx      *oto.Context
+	clips    map[Sound][]byte
+	playing  []*oto.Player
+	settings *Settings
+}
+
+func newAudio(settings *Settings) *Audio {
+	a := &Audio{
+		clips:    make(map[Sound][]byte),
+		settings: settings,
+	}
+	for sound, tones := range soundTones {
+		a.clips[sound] = synthesize(tones)
+	}
+
+	ctx, ready, err := oto.NewContext(&oto.NewContextOptions{
+		SampleRate:   audioSampleRate,
+		ChannelCount: 1,
+		Format:       oto.FormatSignedInt16LE,
+	})
+	if err != nil {
+		return a
+	}
+	<-ready
+	a.ctx = ctx
+	return a
+}
+
+// play starts a cue without waiting for it to finish
+func (a *Audio) play(sound Sound) {
+	if a.ctx == nil || a.settings.Muted {
+		return
+	}
+
+	// Players must stay referenced until they finish
+	active := a.playing[:0]
+	for _, p := range a.playing {
+		if p.IsPlaying() {
+			active = append(active, p)
+		}
+	}
+	a.playing = active
+
+	p := a.ctx.NewPlayer(bytes.NewReader(a.clips[sound]))
+	p.SetVolume(a.settings.Volume)
+	p.Play()
+	a.playing = append(a.playing, p)
+}
+
+// synthesize renders tones as 16-bit mono PCM with a short fade in and out
+// on each note to avoid clicks
+func synthesize(tones []tone) []byte {
+	var buf bytes.Buffer
+	fade := audioSampleRate / 200 // 5ms
+	for _, t := range tones {
+		n := int(t.dur.Seconds() * audioSampleRate)
+		for i := 0; i < n; i++ {
+			var sample float64
+			if t.freq > 0 {
+				sample = math.Sin(2 * math.Pi * t.freq * float64(i) / audioSampleRate)
+				if i < fade {
+					sample *= float64(i) / float64(fade)
+				}
+				if n-i < fade {
+					sample *= float64(n-i) / float64(fade)
+				}
+			}
+			binary.Write(&buf, binary.LittleEndian, int16(sample*0.5*math.MaxInt16))
+		}
+	}
+	return buf.Bytes()
+}
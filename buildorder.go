@@ -0,0 +1,424 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+)
+
+// buildOrdersFile holds build orders for build-order mode
+const buildOrdersFile = "build_orders.txt"
+
+const (
+	// workerTime estimates game time from a supply count: one worker at a
+	// time from the starting 4 supply
+	workerTime  = 12600 * time.Millisecond
+	startSupply = 4
+
+	buildFrame  = 100 * time.Millisecond // game clock refresh
+	buildOnTime = time.Second            // offsets within this count as on time
+)
+
+// BuildStep is one line of a build order
+type BuildStep struct {
+	Supply int           `json:"supply,omitempty"` // 0 if the marker is a time
+	At     time.Duration `json:"at"`               // game time the step is due
+	Action string        `json:"action"`
+	Keys   string        `json:"keys"` // pattern tokens that execute it
+}
+
+// BuildOrder is a named list of steps in game-time order
+type BuildOrder struct {
+	Name  string      `json:"name"`
+	Steps []BuildStep `json:"steps"`
+}
+
+var defaultBuildOrders = []BuildOrder{
+	{"Terran 2 Rax", []BuildStep{
+		{Supply: 9, At: 63 * time.Second, Action: "Supply Depot", Keys: "LCbsLC"},
+		{Supply: 11, At: 88 * time.Second, Action: "Barracks", Keys: "LCbbLC"},
+		{Supply: 13, At: 113 * time.Second, Action: "Barracks", Keys: "LCbbLC"},
+		{Supply: 15, At: 139 * time.Second, Action: "Supply Depot", Keys: "LCbsLC"},
+		{At: 150 * time.Second, Action: "Rally", Keys: "F2LCrLC"},
+		{At: 165 * time.Second, Action: "Marines", Keys: "1mm"},
+	}},
+}
+
+// buildRun is a build order being played against the game clock
+type buildRun struct {
+	order    BuildOrder
+	start    time.Time // game time 0:00
+	prompted bool      // the current step's keys are showing
+	offsets  []time.Duration
+	stop     chan struct{}
+}
+
+// BuildStats tracks runs of one build order
+type BuildStats struct {
+	Name           string          `json:"name"`
+	Attempts       int             `json:"attempts"`
+	BestMeanOffset time.Duration   `json:"best_mean_offset"` // lowest mean |offset| of a full run
+	LastOffsets    []time.Duration `json:"last_offsets"`     // per step, negative is early
+	LastPracticed  time.Time       `json:"last_practiced"`
+}
+
+// loadBuildOrders loads build orders from the working directory or next to
+// the executable, or returns the defaults
+func loadBuildOrders() []BuildOrder {
+	orders, err := loadBuildOrdersFromFile(buildOrdersFile)
+	if err == nil && len(orders) > 0 {
+		return orders
+	}
+
+	exePath, err := os.Executable()
+	if err == nil {
+		orders, err = loadBuildOrdersFromFile(filepath.Join(filepath.Dir(exePath), buildOrdersFile))
+		if err == nil && len(orders) > 0 {
+			return orders
+		}
+	}
+
+	return defaultBuildOrders
+}
+
+// loadBuildOrdersFromFile reads "[Name]" headers each followed by
+// "marker|action|keys" steps. Malformed steps are skipped.
+func loadBuildOrdersFromFile(path string) ([]BuildOrder, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var orders []BuildOrder
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			orders = append(orders, BuildOrder{Name: strings.TrimSpace(line[1 : len(line)-1])})
+			continue
+		}
+
+		parts := strings.SplitN(line, "|", 3)
+		if len(orders) == 0 || len(parts) != 3 || strings.TrimSpace(parts[2]) == "" {
+			continue
+		}
+		supply, at, ok := parseBuildMarker(strings.TrimSpace(parts[0]))
+		if !ok {
+			continue
+		}
+		order := &orders[len(orders)-1]
+		order.Steps = append(order.Steps, BuildStep{
+			Supply: supply,
+			At:     at,
+			Action: strings.TrimSpace(parts[1]),
+			Keys:   strings.TrimSpace(parts[2]),
+		})
+	}
+
+	for i := range orders {
+		sort.SliceStable(orders[i].Steps, func(a, b int) bool {
+			return orders[i].Steps[a].At < orders[i].Steps[b].At
+		})
+	}
+	var valid []BuildOrder
+	for _, o := range orders {
+		if len(o.Steps) > 0 {
+			valid = append(valid, o)
+		}
+	}
+	return valid, scanner.Err()
+}
+
+// parseBuildMarker reads a game time ("1:05"), a supply count ("12") or
+// both ("12@1:05"). A bare supply count is turned into an estimated time.
+func parseBuildMarker(marker string) (int, time.Duration, bool) {
+	supplyPart, timePart := marker, ""
+	if before, after, found := strings.Cut(marker, "@"); found {
+		supplyPart, timePart = before, after
+	} else if strings.Contains(marker, ":") {
+		supplyPart, timePart = "", marker
+	}
+
+	supply := 0
+	if supplyPart != "" {
+		n, err := strconv.Atoi(supplyPart)
+		if err != nil || n < 0 {
+			return 0, 0, false
+		}
+		supply = n
+	}
+
+	if timePart == "" {
+		return supply, time.Duration(max(supply-startSupply, 0)) * workerTime, true
+	}
+	minutes, seconds, found := strings.Cut(timePart, ":")
+	m, err1 := strconv.Atoi(minutes)
+	s, err2 := strconv.Atoi(seconds)
+	if !found || err1 != nil || err2 != nil || m < 0 || s < 0 || s > 59 {
+		return 0, 0, false
+	}
+	return supply, time.Duration(m)*time.Minute + time.Duration(s)*time.Second, true
+}
+
+// formatGameTime shows a game time as m:ss
+func formatGameTime(d time.Duration) string {
+	if d < 0 {
+		return "-" + formatGameTime(-d)
+	}
+	d = d.Truncate(time.Second)
+	return fmt.Sprintf("%d:%02d", int(d.Minutes()), int(d.Seconds())%60)
+}
+
+// marker describes when a step is due
+func (s BuildStep) marker() string {
+	if s.Supply > 0 {
+		return fmt.Sprintf("%d supply • %s", s.Supply, formatGameTime(s.At))
+	}
+	return formatGameTime(s.At)
+}
+
+// buildOrder returns the selected build order, or the first one
+func (app *App) buildOrder() BuildOrder {
+	for _, o := range app.buildOrders {
+		if o.Name == app.settings.BuildOrder {
+			return o
+		}
+	}
+	if len(app.buildOrders) == 0 {
+		return defaultBuildOrders[0]
+	}
+	return app.buildOrders[0]
+}
+
+// cycleBuildOrder selects the next build order and remembers it
+func (app *App) cycleBuildOrder() {
+	if len(app.buildOrders) == 0 {
+		return
+	}
+	current := app.buildOrder().Name
+	next := app.buildOrders[0]
+	for i, o := range app.buildOrders {
+		if o.Name == current {
+			next = app.buildOrders[(i+1)%len(app.buildOrders)]
+		}
+	}
+	app.settings.BuildOrder = next.Name
+	app.settings.save()
+
+	app.statusLabel.Text = fmt.Sprintf("Build order: %s (%d steps)", next.Name, len(next.Steps))
+	app.statusLabel.Color = app.palette.Info
+	app.statusLabel.Refresh()
+}
+
+// beginBuild queues the steps of the selected build order and starts the
+// game clock
+func (app *App) beginBuild() {
+	order := app.buildOrder()
+	app.patternQueue = nil
+	for _, step := range order.Steps {
+		app.patternQueue = append(app.patternQueue, Pattern{Name: step.Action, Pattern: step.Keys})
+	}
+
+	app.build = &buildRun{
+		order: order,
+		start: app.now(),
+		stop:  make(chan struct{}),
+	}
+	go func(stop chan struct{}) {
+		ticker := time.NewTicker(buildFrame)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				fyne.Do(app.tickBuild)
+			}
+		}
+	}(app.build.stop)
+}
+
+func (app *App) stopBuild() {
+	if app.build == nil {
+		return
+	}
+	close(app.build.stop)
+	app.build = nil
+}
+
+// currentStep is the step being prompted or waited for
+func (app *App) currentStep() BuildStep {
+	return app.build.order.Steps[len(app.build.offsets)]
+}
+
+// buildLead is how long before its time a step's keys appear
+func (app *App) buildLead() time.Duration {
+	return time.Duration(max(app.settings.BuildLeadMs, 0)) * time.Millisecond
+}
+
+// waitBuildStep shows the upcoming step without its keys until it is due
+func (app *App) waitBuildStep() {
+	step := app.currentStep()
+	app.build.prompted = false
+	app.isActive = false
+
+	app.patternName.Text = "⚒ " + step.Action
+	app.patternName.Refresh()
+	app.bestTimeLabel.Text = fmt.Sprintf("%s • step %d/%d", step.marker(), len(app.build.offsets)+1, len(app.build.order.Steps))
+	app.bestTimeLabel.Color = app.palette.Info
+	app.bestTimeLabel.Refresh()
+	app.targetDisplay.Text = "…"
+	app.targetDisplay.Refresh()
+	app.inputDisplay.Text = ""
+	app.inputDisplay.Refresh()
+	app.updateClickZone()
+
+	app.tickBuild()
+}
+
+// tickBuild advances the game clock display and prompts the current step
+// once it is within the lead time
+func (app *App) tickBuild() {
+	if app.build == nil || len(app.build.offsets) == len(app.build.order.Steps) {
+		return
+	}
+	clock := app.now().Sub(app.build.start)
+	step := app.currentStep()
+
+	app.progressLabel.Text = fmt.Sprintf("⏱ %s • %s at %s", formatGameTime(clock), step.Action, formatGameTime(step.At))
+	app.progressLabel.Color = app.palette.Progress
+	app.progressLabel.Refresh()
+
+	// A replay prompts on its recorded step events instead
+	if !app.playback && !app.build.prompted && clock >= step.At-app.buildLead() {
+		app.promptBuildStep()
+	}
+}
+
+// promptBuildStep shows the current step's keys and accepts input
+func (app *App) promptBuildStep() {
+	if app.build == nil || app.build.prompted {
+		return
+	}
+	app.build.prompted = true
+	app.isActive = true
+
+	app.targetDisplay.Text = formatForDisplay(app.currentPattern.Pattern)
+	app.targetDisplay.Refresh()
+	app.inputDisplay.Text = "▌"
+	app.inputDisplay.Color = app.palette.Muted
+	app.inputDisplay.Refresh()
+	app.updateClickZone()
+
+	app.lastOutcome = ""
+	app.record(replayEvent{Kind: "step", Cell: -1})
+}
+
+// finishBuildStep scores a step by how far from its time it was executed
+func (app *App) finishBuildStep() {
+	step := app.currentStep()
+	offset := app.now().Sub(app.build.start.Add(step.At))
+	app.build.offsets = append(app.build.offsets, offset)
+	if app.perfectRun() {
+		app.sessionPerfect++
+	}
+
+	switch {
+	case offset.Abs() <= buildOnTime:
+		app.statusLabel.Text = fmt.Sprintf("✅ %s on time (%+.1fs)", step.Action, offset.Seconds())
+		app.statusLabel.Color = app.palette.Success
+	case offset < 0:
+		app.statusLabel.Text = fmt.Sprintf("⏪ %s %.1fs early", step.Action, -offset.Seconds())
+		app.statusLabel.Color = app.palette.Info
+	default:
+		app.statusLabel.Text = fmt.Sprintf("⏩ %s %.1fs late", step.Action, offset.Seconds())
+		app.statusLabel.Color = app.palette.Warning
+	}
+	app.statusLabel.Refresh()
+	app.inputDisplay.Color = app.palette.Done
+	app.inputDisplay.Refresh()
+	app.audio.play(soundComplete)
+}
+
+// finishBuild shows how the whole build went and saves it
+func (app *App) finishBuild() {
+	run := app.build
+	app.stopBuild()
+
+	var total time.Duration
+	early, late := 0, 0
+	for _, off := range run.offsets {
+		total += off.Abs()
+		if off < -buildOnTime {
+			early++
+		} else if off > buildOnTime {
+			late++
+		}
+	}
+	mean := total / time.Duration(max(len(run.offsets), 1))
+	best := app.stats.recordBuild(run.order.Name, run.offsets, mean)
+	app.stats.save()
+
+	app.patternName.Text = "⚒ " + run.order.Name + " complete"
+	app.patternName.Color = app.palette.Best
+	app.patternName.Refresh()
+
+	app.bestTimeLabel.Text = fmt.Sprintf("Mean offset ±%.1fs • %d early • %d late", mean.Seconds(), early, late)
+	app.bestTimeLabel.Color = app.palette.Muted
+	app.bestTimeLabel.Refresh()
+
+	app.targetDisplay.Text = "🎉"
+	app.targetDisplay.Refresh()
+
+	app.inputDisplay.Text = ""
+	app.inputDisplay.Refresh()
+
+	if best {
+		app.statusLabel.Text = "🏆 Tightest run of this build yet!"
+		app.statusLabel.Color = app.palette.Best
+	} else {
+		app.statusLabel.Text = fmt.Sprintf("%d/%d steps without mistakes", app.sessionPerfect, len(run.offsets))
+		app.statusLabel.Color = app.palette.Success
+	}
+	app.statusLabel.Refresh()
+
+	app.progressLabel.Text = ""
+	app.progressLabel.Refresh()
+
+	app.hintLabel.Text = "Press SPACE to train again"
+	app.hintLabel.Refresh()
+
+	app.audio.play(soundSessionComplete)
+}
+
+// recordBuild stores a full run and reports whether it was the best yet
+func (s *AllStats) recordBuild(name string, offsets []time.Duration, mean time.Duration) bool {
+	if s.Builds == nil {
+		s.Builds = make(map[string]*BuildStats)
+	}
+	bs, ok := s.Builds[name]
+	if !ok {
+		bs = &BuildStats{Name: name}
+		s.Builds[name] = bs
+	}
+	bs.Attempts++
+	bs.LastOffsets = offsets
+	bs.LastPracticed = time.Now()
+
+	if bs.BestMeanOffset == 0 || mean < bs.BestMeanOffset {
+		bs.BestMeanOffset = mean
+		return true
+	}
+	return false
+}
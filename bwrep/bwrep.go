@@ -0,0 +1,561 @@
+// Package bwrep mines trainable hotkey sequences from Brood War replays.
+// A .rep file is a series of sections, each split into 8KB chunks that are
+// stored raw, PKWARE imploded (before 1.18) or zlib compressed (1.18+). We
+// need the header for the player list and the command section for what
+// each player did.
+package bwrep
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	repChunkSize  = 8192
+	repHeaderSize = 0x279
+	repFrame      = 42 * time.Millisecond // one game frame on Fastest
+	repIdleGap    = 48                    // frames without commands that end a sequence
+)
+
+type repPlayer struct {
+	ID    byte // player ID used in commands
+	Name  string
+	Race  string
+	Human bool
+}
+
+type repCommand struct {
+	Frame  uint32
+	Player byte
+	Type   byte
+	Params []byte
+}
+
+type bwReplay struct {
+	Players  []repPlayer
+	Commands []repCommand
+}
+
+var repRaces = map[byte]string{0: "Zerg", 1: "Terran", 2: "Protoss", 6: "Random"}
+
+// repReader walks the sections of a replay file
+type repReader struct {
+	data   []byte
+	pos    int
+	modern bool
+}
+
+func (r *repReader) u32() (uint32, error) {
+	if r.pos+4 > len(r.data) {
+		return 0, io.ErrUnexpectedEOF
+	}
+	v := binary.LittleEndian.Uint32(r.data[r.pos:])
+	r.pos += 4
+	return v, nil
+}
+
+// section reads and decompresses the next section of the given size
+func (r *repReader) section(size int) ([]byte, error) {
+	if _, err := r.u32(); err != nil { // checksum
+		return nil, err
+	}
+	chunks, err := r.u32()
+	if err != nil {
+		return nil, err
+	}
+
+	var out []byte
+	for i := 0; i < int(chunks); i++ {
+		n, err := r.u32()
+		if err != nil {
+			return nil, err
+		}
+		if r.pos+int(n) > len(r.data) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		chunk := r.data[r.pos : r.pos+int(n)]
+		r.pos += int(n)
+
+		// A chunk that is as long as its decompressed size is stored raw
+		if int(n) >= min(repChunkSize, size-len(out)) {
+			out = append(out, chunk...)
+			continue
+		}
+		var data []byte
+		if r.modern && len(chunk) > 0 && chunk[0] == 0x78 {
+			zr, err := zlib.NewReader(bytes.NewReader(chunk))
+			if err != nil {
+				return nil, err
+			}
+			data, err = io.ReadAll(zr)
+			if err != nil {
+				return nil, err
+			}
+		} else if data, err = explode(chunk); err != nil {
+			return nil, err
+		}
+		out = append(out, data...)
+	}
+
+	if len(out) < size {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return out[:size], nil
+}
+
+func parseRep(path string) (*bwReplay, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 30 {
+		return nil, fmt.Errorf("%s: not a replay", path)
+	}
+	r := &repReader{data: data, modern: string(data[12:16]) == "seRS"}
+
+	id, err := r.section(4)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if s := string(id); s != "reRS" && s != "seRS" {
+		return nil, fmt.Errorf("%s: not a Brood War replay", path)
+	}
+	// 1.21+ puts an extra 4-byte section before the header, so the header
+	// does not start with a zlib stream
+	if r.modern && data[28] != 0x78 {
+		if _, err := r.section(4); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	header, err := r.section(repHeaderSize)
+	if err != nil {
+		return nil, fmt.Errorf("%s: header: %w", path, err)
+	}
+	length, err := r.section(4)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	commands, err := r.section(int(binary.LittleEndian.Uint32(length)))
+	if err != nil {
+		return nil, fmt.Errorf("%s: commands: %w", path, err)
+	}
+
+	rep := &bwReplay{Players: parseRepPlayers(header)}
+	rep.Commands = parseRepCommands(commands)
+	return rep, nil
+}
+
+// parseRepPlayers reads the 12 player slots of the header
+func parseRepPlayers(header []byte) []repPlayer {
+	var players []repPlayer
+	for i := 0; i < 12; i++ {
+		slot := header[0xA1+i*36 : 0xA1+(i+1)*36]
+		kind := slot[8]
+		if kind == 0 {
+			continue
+		}
+		name := slot[11:36]
+		if end := bytes.IndexByte(name, 0); end >= 0 {
+			name = name[:end]
+		}
+		players = append(players, repPlayer{
+			ID:    slot[4],
+			Name:  string(name),
+			Race:  repRaces[slot[9]],
+			Human: kind == 2,
+		})
+	}
+	return players
+}
+
+// repCommandSizes is the parameter length of each fixed-size command
+var repCommandSizes = map[byte]int{
+	0x0C: 7, 0x0D: 2, 0x0E: 4, 0x0F: 1, 0x10: 0, 0x11: 0, 0x12: 4, 0x13: 2,
+	0x14: 9, 0x15: 10, 0x18: 0, 0x19: 0, 0x1A: 1, 0x1B: 0, 0x1C: 0, 0x1D: 0,
+	0x1E: 1, 0x1F: 2, 0x20: 2, 0x21: 1, 0x22: 1, 0x23: 2, 0x25: 1, 0x26: 1,
+	0x27: 0, 0x28: 1, 0x29: 2, 0x2A: 0, 0x2B: 1, 0x2C: 1, 0x2D: 1, 0x2E: 0,
+	0x2F: 4, 0x30: 1, 0x31: 0, 0x32: 1, 0x33: 0, 0x34: 0, 0x35: 2, 0x36: 0,
+	0x37: 6, 0x38: 0, 0x39: 0, 0x3A: 1, 0x3B: 1, 0x3C: 0, 0x3D: 1, 0x3E: 5,
+	0x3F: 7, 0x40: 17, 0x41: 2, 0x42: 1, 0x43: 1, 0x44: 2, 0x45: 2, 0x48: 12,
+	0x55: 0, 0x56: 1, 0x57: 9, 0x58: 1, 0x59: 4, 0x5A: 0, 0x5B: 0, 0x5C: 81,
+	0x60: 11, 0x61: 12, 0x62: 4,
+}
+
+// repSelectUnitSize is the per-unit length of the variable-size selection
+// commands: 0x09-0x0B before 1.21, 0x63-0x65 after
+var repSelectUnitSize = map[byte]int{
+	0x09: 2, 0x0A: 2, 0x0B: 2,
+	0x63: 4, 0x64: 4, 0x65: 4,
+}
+
+// parseRepCommands splits the command section into frame blocks. A command
+// we don't know the size of skips the rest of its block.
+func parseRepCommands(data []byte) []repCommand {
+	var commands []repCommand
+	for pos := 0; pos+5 <= len(data); {
+		frame := binary.LittleEndian.Uint32(data[pos:])
+		end := pos + 5 + int(data[pos+4])
+		if end > len(data) {
+			break
+		}
+
+		for p := pos + 5; p+2 <= end; {
+			player, typ := data[p], data[p+1]
+			p += 2
+			size, ok := repCommandSizes[typ]
+			if unit, sel := repSelectUnitSize[typ]; sel && p < end {
+				size, ok = 1+int(data[p])*unit, true
+			}
+			if !ok || p+size > end {
+				break
+			}
+			commands = append(commands, repCommand{
+				Frame:  frame,
+				Player: player,
+				Type:   typ,
+				Params: data[p : p+size],
+			})
+			p += size
+		}
+		pos = end
+	}
+	return commands
+}
+
+// Default Brood War hotkeys for the orders, units and buildings we map.
+// Anything else can't be typed as a pattern and ends a sequence.
+var (
+	repOrderKeys = map[byte]string{
+		6: "m", 8: "a", 9: "a", 10: "a", 14: "a", 34: "r", 39: "r", 40: "r",
+		79: "g", 113: "y", 115: "l", 119: "w", 121: "b", 122: "e", 128: "n",
+		132: "i", 137: "r", 139: "s", 141: "d", 142: "t", 143: "i", 144: "g",
+		145: "c", 146: "e", 147: "w", 152: "p",
+	}
+	repTrainKeys = map[uint16]string{
+		// Terran
+		0: "m", 1: "g", 2: "v", 3: "g", 5: "t", 7: "s", 8: "w", 9: "v",
+		11: "d", 12: "b", 32: "f", 34: "c", 58: "y",
+		// Zerg larva and unit morphs
+		37: "z", 38: "h", 39: "u", 41: "d", 42: "o", 43: "m", 44: "g",
+		45: "q", 46: "f", 47: "s", 62: "d", 103: "l",
+		// Protoss
+		60: "c", 61: "k", 64: "p", 65: "z", 66: "d", 67: "t", 69: "s",
+		70: "s", 71: "a", 72: "c", 83: "v", 84: "o",
+	}
+	repBuildKeys = map[uint16]string{
+		// Terran
+		106: "bc", 109: "bs", 110: "br", 111: "bb", 112: "ba", 113: "vf",
+		114: "vs", 116: "vi", 122: "be", 123: "va", 124: "bt", 125: "bu",
+		// Zerg
+		131: "bh", 134: "vn", 135: "bd", 136: "vd", 138: "vq", 139: "bv",
+		140: "vu", 141: "vs", 142: "bs", 143: "bc", 149: "be",
+		// Protoss
+		154: "bn", 155: "vr", 156: "bp", 157: "ba", 159: "vo", 160: "bg",
+		162: "bc", 163: "vc", 164: "by", 165: "vt", 166: "bf", 167: "vs",
+		169: "vf", 170: "va", 171: "vb", 172: "bb",
+	}
+	repMorphKeys  = map[uint16]string{132: "l", 133: "h", 137: "g", 144: "s", 146: "u"}
+	repSimpleKeys = map[byte]string{
+		0x1A: "s", 0x1E: "c", 0x21: "c", 0x22: "c", 0x25: "o", 0x26: "o",
+		0x28: "u", 0x2A: "r", 0x2B: "h", 0x2C: "u", 0x2D: "u", 0x36: "t",
+	}
+)
+
+// Action kinds, used to name mined sequences
+const (
+	repGroup  = "group"
+	repSelect = "select"
+	repOrder  = "order"
+	repTrain  = "train"
+	repBuild  = "build"
+)
+
+// repAction is one trainable step: the pattern tokens for a command
+type repAction struct {
+	frame uint32
+	token string // "" for a command that can't be trained
+	kind  string
+	group int
+}
+
+// action maps a command to the keys and clicks that issue it
+func (c repCommand) action() repAction {
+	a := repAction{frame: c.Frame, group: -1}
+	p := c.Params
+	u16 := func(off int) uint16 { return binary.LittleEndian.Uint16(p[off:]) }
+	click := func(queued byte) string {
+		if queued != 0 {
+			return "SLC"
+		}
+		return "LC"
+	}
+
+	switch c.Type {
+	case 0x13: // hotkey: 0 assign, 1 select, 2 add
+		if p[0] == 1 && p[1] <= 9 {
+			a.token, a.kind, a.group = strconv.Itoa(int(p[1])), repGroup, int(p[1])
+		}
+	case 0x09, 0x63:
+		a.kind, a.token = repSelect, "DRAG"
+		if p[0] == 1 {
+			a.token = "LC"
+		}
+	case 0x0A, 0x0B, 0x64, 0x65:
+		a.kind, a.token = repSelect, "SLC"
+	case 0x14, 0x60: // right click; queued flag is the last byte
+		a.kind, a.token = repOrder, "RC"
+		if p[len(p)-1] != 0 {
+			a.token = "SRC"
+		}
+	case 0x15, 0x61: // targeted order; 1.21 adds two bytes before the unit type
+		off := 8
+		if c.Type == 0x61 {
+			off = 10
+		}
+		if key, ok := repOrderKeys[p[off]]; ok {
+			a.kind, a.token = repOrder, key+click(p[off+1])
+		}
+	case 0x0C:
+		if key, ok := repBuildKeys[u16(5)]; ok {
+			a.kind, a.token = repBuild, key+"LC"
+		}
+	case 0x1F, 0x23:
+		if key, ok := repTrainKeys[u16(0)]; ok {
+			a.kind, a.token = repTrain, key
+		}
+	case 0x35:
+		if key, ok := repMorphKeys[u16(0)]; ok {
+			a.kind, a.token = repTrain, key
+		}
+	default:
+		if key, ok := repSimpleKeys[c.Type]; ok {
+			a.kind, a.token = repOrder, key
+		}
+	}
+	return a
+}
+
+// findRepPlayer picks a player by name, or the only human if name is empty
+func (rep *bwReplay) findRepPlayer(name string) (repPlayer, error) {
+	var humans []string
+	for _, p := range rep.Players {
+		if name != "" && strings.EqualFold(p.Name, name) {
+			return p, nil
+		}
+		if p.Human {
+			humans = append(humans, p.Name)
+		}
+	}
+	if name == "" && len(humans) == 1 {
+		return rep.findRepPlayer(humans[0])
+	}
+	return repPlayer{}, fmt.Errorf("choose a player with -player: %s", strings.Join(humans, ", "))
+}
+
+// repSegments returns a player's actions as runs of trainable tokens, split
+// wherever they paused or did something untrainable. Two selects of the same
+// group within the double interval become a double-tap.
+func (rep *bwReplay) repSegments(player byte, double time.Duration) [][]repAction {
+	doubleFrames := uint32(double / repFrame)
+
+	var segments [][]repAction
+	var current []repAction
+	flush := func() {
+		if len(current) > 0 {
+			segments = append(segments, current)
+		}
+		current = nil
+	}
+
+	for _, c := range rep.Commands {
+		if c.Player != player {
+			continue
+		}
+		a := c.action()
+		if a.token == "" {
+			flush()
+			continue
+		}
+		if n := len(current); n > 0 {
+			last := &current[n-1]
+			if a.frame-last.frame > repIdleGap {
+				flush()
+			} else if a.kind == repGroup && last.kind == repGroup && a.group == last.group &&
+				!strings.HasPrefix(last.token, "DT") && a.frame-last.frame <= doubleFrames {
+				last.token = "DT" + a.token
+				continue
+			}
+		}
+		current = append(current, a)
+	}
+	flush()
+	return segments
+}
+
+// repSequence is a run of actions and how often it was repeated
+type repSequence struct {
+	actions []repAction
+	count   int
+}
+
+func (s repSequence) pattern() string {
+	var b strings.Builder
+	for _, a := range s.actions {
+		b.WriteString(a.token)
+	}
+	return b.String()
+}
+
+// mineSequences counts every run of minLen to maxLen actions (without
+// overlapping itself) and returns the top ones by count × length, dropping
+// runs contained in a better one and runs of a single repeated action
+func mineSequences(segments [][]repAction, minLen, maxLen, top int) []repSequence {
+	type tally struct {
+		seq     repSequence
+		lastEnd map[int]int // segment -> end of the last counted occurrence
+	}
+	tallies := make(map[string]*tally)
+
+	for si, seg := range segments {
+		for n := minLen; n <= maxLen; n++ {
+			for i := 0; i+n <= len(seg); i++ {
+				run := seg[i : i+n]
+				distinct := false
+				for _, a := range run[1:] {
+					if a.token != run[0].token {
+						distinct = true
+					}
+				}
+				if !distinct {
+					continue
+				}
+
+				key := repSequence{actions: run}.pattern()
+				t, ok := tallies[key]
+				if !ok {
+					t = &tally{seq: repSequence{actions: run}, lastEnd: make(map[int]int)}
+					tallies[key] = t
+				}
+				if end, seen := t.lastEnd[si]; seen && i < end {
+					continue
+				}
+				t.lastEnd[si] = i + n
+				t.seq.count++
+			}
+		}
+	}
+
+	var all []repSequence
+	for _, t := range tallies {
+		if t.seq.count >= 2 {
+			all = append(all, t.seq)
+		}
+	}
+	sort.Slice(all, func(i, j int) bool {
+		si := all[i].count * len(all[i].actions)
+		sj := all[j].count * len(all[j].actions)
+		if si != sj {
+			return si > sj
+		}
+		return all[i].pattern() < all[j].pattern()
+	})
+
+	var picked []repSequence
+	for _, s := range all {
+		if len(picked) == top {
+			break
+		}
+		overlap := false
+		for _, p := range picked {
+			if strings.Contains(p.pattern(), s.pattern()) || strings.Contains(s.pattern(), p.pattern()) {
+				overlap = true
+				break
+			}
+		}
+		if !overlap {
+			picked = append(picked, s)
+		}
+	}
+	return picked
+}
+
+// name describes a sequence by what it mostly does and the groups it uses
+func (s repSequence) name(player string) string {
+	kinds := make(map[string]bool)
+	var groups []string
+	for _, a := range s.actions {
+		kinds[a.kind] = true
+		if a.kind == repGroup {
+			g := strconv.Itoa(a.group)
+			if len(groups) == 0 || groups[len(groups)-1] != g {
+				groups = append(groups, g)
+			}
+		}
+	}
+
+	what := "Control"
+	switch {
+	case kinds[repBuild]:
+		what = "Build"
+	case kinds[repTrain]:
+		what = "Macro"
+	case kinds[repOrder]:
+		what = "Micro"
+	case kinds[repSelect]:
+		what = "Select"
+	}
+	name := player + " " + what
+	if len(groups) > 0 {
+		name += " " + strings.Join(groups, "-")
+	}
+	return name
+}
+
+// Import mines one player's most repeated sequences from the given replays
+// and writes them in keystroke_patterns.txt format
+func Import(w io.Writer, paths []string, player string, top int, double time.Duration) error {
+	if len(paths) == 0 {
+		return fmt.Errorf("no replay files given")
+	}
+
+	var segments [][]repAction
+	var name string
+	for _, path := range paths {
+		rep, err := parseRep(path)
+		if err != nil {
+			return err
+		}
+		p, err := rep.findRepPlayer(player)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		name = p.Name
+		segments = append(segments, rep.repSegments(p.ID, double)...)
+	}
+
+	sequences := mineSequences(segments, 3, 8, top)
+	if len(sequences) == 0 {
+		return fmt.Errorf("no repeated sequences found for %s", name)
+	}
+
+	fmt.Fprintf(w, "# Mined from %d replay(s) of %s\n", len(paths), name)
+	used := make(map[string]int)
+	for _, s := range sequences {
+		n := s.name(name)
+		used[n]++
+		if used[n] > 1 {
+			n = fmt.Sprintf("%s #%d", n, used[n])
+		}
+		fmt.Fprintf(w, "# seen %d times\n%s|%s\n", s.count, n, s.pattern())
+	}
+	return nil
+}
@@ -0,0 +1,372 @@
+package bwrep
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The sample replays in testdata are written by testdata/mkrep.go
+
+func readFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// writeTemp writes a replay variant to a temporary file
+func writeTemp(t *testing.T, data []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "game.rep")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestParseRep(t *testing.T) {
+	tests := []struct {
+		file     string
+		players  []repPlayer
+		commands int
+		first    repCommand
+	}{
+		{
+			file: "legacy.rep",
+			players: []repPlayer{
+				{ID: 0, Name: "Flash", Race: "Terran", Human: true},
+				{ID: 1, Name: "Jaedong", Race: "Zerg", Human: true},
+			},
+			commands: 880,
+			first:    repCommand{Frame: 309, Player: 0, Type: 0x13, Params: []byte{1, 1}},
+		},
+		{
+			file: "modern.rep",
+			players: []repPlayer{
+				{ID: 0, Name: "Bisu", Race: "Protoss", Human: true},
+				{ID: 1, Name: "Computer", Race: "Terran", Human: false},
+			},
+			commands: 200,
+			first:    repCommand{Frame: 411, Player: 0, Type: 0x13, Params: []byte{1, 3}},
+		},
+		{
+			file: "remastered.rep",
+			players: []repPlayer{
+				{ID: 0, Name: "Light", Race: "Terran", Human: true},
+				{ID: 1, Name: "Soulkey", Race: "Zerg", Human: true},
+			},
+			commands: 270,
+			first:    repCommand{Frame: 517, Player: 0, Type: 0x63, Params: []byte{3, 12, 0, 0, 0, 13, 0, 0, 0, 14, 0, 0, 0}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			rep, err := parseRep(filepath.Join("testdata", tt.file))
+			if err != nil {
+				t.Fatalf("parseRep: %v", err)
+			}
+			if !reflect.DeepEqual(rep.Players, tt.players) {
+				t.Errorf("players = %+v, want %+v", rep.Players, tt.players)
+			}
+			if len(rep.Commands) != tt.commands {
+				t.Errorf("%d commands, want %d", len(rep.Commands), tt.commands)
+			}
+			if len(rep.Commands) > 0 && !reflect.DeepEqual(rep.Commands[0], tt.first) {
+				t.Errorf("first command = %+v, want %+v", rep.Commands[0], tt.first)
+			}
+		})
+	}
+}
+
+func TestParseRepInvalid(t *testing.T) {
+	legacy := readFixture(t, "legacy.rep")
+	modern := readFixture(t, "modern.rep")
+
+	wrongID := bytes.Clone(modern)
+	copy(wrongID[12:], "xxRS")
+	badDict := bytes.Clone(legacy)
+	badDict[29] = 9 // dictionary size of the imploded header chunk
+	badZlib := bytes.Clone(modern)
+	badZlib[29] ^= 0xFF // zlib flags of the header chunk
+
+	tests := []struct {
+		name string
+		data []byte
+		want error  // matched with errors.Is, or
+		text string // contained in the message
+	}{
+		{name: "too short", data: legacy[:20], text: "not a replay"},
+		{name: "not a replay", data: wrongID, text: "not a Brood War replay"},
+		{name: "cut in the header", data: legacy[:60], want: io.ErrUnexpectedEOF},
+		{name: "cut in the commands", data: legacy[:len(legacy)/2], want: io.ErrUnexpectedEOF},
+		{name: "corrupt implode", data: badDict, want: errExplode},
+		{name: "corrupt zlib", data: badZlib, text: "zlib"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseRep(writeTemp(t, tt.data))
+			switch {
+			case err == nil:
+				t.Fatal("parseRep succeeded")
+			case tt.want != nil && !errors.Is(err, tt.want):
+				t.Errorf("error = %v, want %v", err, tt.want)
+			case tt.text != "" && !strings.Contains(err.Error(), tt.text):
+				t.Errorf("error = %v, want it to mention %q", err, tt.text)
+			}
+		})
+	}
+
+	if _, err := parseRep(filepath.Join(t.TempDir(), "missing.rep")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("missing file error = %v", err)
+	}
+}
+
+func TestParseRepPlayers(t *testing.T) {
+	header := make([]byte, repHeaderSize)
+	slot := func(i int) []byte { return header[0xA1+i*36 : 0xA1+(i+1)*36] }
+	// An open slot between players is skipped; a name fills its field
+	s := slot(0)
+	s[4], s[8], s[9] = 3, 2, 2
+	copy(s[11:], "Stork")
+	s = slot(2)
+	s[4], s[8], s[9] = 5, 1, 6
+	copy(s[11:], "0123456789012345678901234")
+
+	want := []repPlayer{
+		{ID: 3, Name: "Stork", Race: "Protoss", Human: true},
+		{ID: 5, Name: "0123456789012345678901234", Race: "Random", Human: false},
+	}
+	if got := parseRepPlayers(header); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseRepPlayers = %+v, want %+v", got, want)
+	}
+}
+
+// block packs one frame's commands the way the command section stores them
+func block(frame uint32, size int, commands ...byte) []byte {
+	b := []byte{byte(frame), byte(frame >> 8), byte(frame >> 16), byte(frame >> 24), byte(size)}
+	return append(b, commands...)
+}
+
+func TestParseRepCommands(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want []repCommand
+	}{
+		{
+			name: "fixed and selection sizes",
+			data: block(10, 11, 0, 0x13, 1, 1, 1, 0x09, 2, 7, 0, 8, 0),
+			want: []repCommand{
+				{Frame: 10, Player: 0, Type: 0x13, Params: []byte{1, 1}},
+				{Frame: 10, Player: 1, Type: 0x09, Params: []byte{2, 7, 0, 8, 0}},
+			},
+		},
+		{
+			name: "1.21 selection",
+			data: block(11, 7, 0, 0x63, 1, 9, 0, 0, 0),
+			want: []repCommand{{Frame: 11, Player: 0, Type: 0x63, Params: []byte{1, 9, 0, 0, 0}}},
+		},
+		{
+			name: "unknown command skips the rest of its block",
+			data: append(block(12, 6, 0, 0xEE, 0, 0x13, 1, 2), block(13, 2, 0, 0x10)...),
+			want: []repCommand{{Frame: 13, Player: 0, Type: 0x10, Params: []byte{}}},
+		},
+		{
+			name: "parameters past the block",
+			data: block(15, 3, 0, 0x1F, 0),
+		},
+		{
+			name: "block past the section",
+			data: block(20, 9, 0, 0x13, 1, 1),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseRepCommands(tt.data)
+			if len(got) != len(tt.want) {
+				t.Fatalf("parseRepCommands = %+v, want %+v", got, tt.want)
+			}
+			for i := range got {
+				if got[i].Frame != tt.want[i].Frame || got[i].Player != tt.want[i].Player ||
+					got[i].Type != tt.want[i].Type || !bytes.Equal(got[i].Params, tt.want[i].Params) {
+					t.Errorf("command %d = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestAction(t *testing.T) {
+	order := func(typ byte, id, queued byte) repCommand {
+		p := make([]byte, 10)
+		if typ == 0x61 {
+			p = make([]byte, 12)
+		}
+		p[len(p)-2], p[len(p)-1] = id, queued
+		return repCommand{Type: typ, Params: p}
+	}
+	tests := []struct {
+		name  string
+		cmd   repCommand
+		token string
+		kind  string
+	}{
+		{"select group", repCommand{Type: 0x13, Params: []byte{1, 3}}, "3", repGroup},
+		{"assign group", repCommand{Type: 0x13, Params: []byte{0, 3}}, "", ""},
+		{"click a unit", repCommand{Type: 0x09, Params: []byte{1, 4, 0}}, "LC", repSelect},
+		{"box select", repCommand{Type: 0x09, Params: []byte{2, 4, 0, 5, 0}}, "DRAG", repSelect},
+		{"shift select", repCommand{Type: 0x65, Params: []byte{1, 4, 0, 0, 0}}, "SLC", repSelect},
+		{"right click", repCommand{Type: 0x14, Params: make([]byte, 9)}, "RC", repOrder},
+		{"queued right click", repCommand{Type: 0x60, Params: append(make([]byte, 10), 1)}, "SRC", repOrder},
+		{"attack", order(0x15, 14, 0), "aLC", repOrder},
+		{"queued attack", order(0x15, 14, 1), "aSLC", repOrder},
+		{"1.21 patrol", order(0x61, 152, 0), "pLC", repOrder},
+		{"unmapped order", order(0x15, 200, 0), "", ""},
+		{"train", repCommand{Type: 0x1F, Params: []byte{0, 0}}, "m", repTrain},
+		{"morph", repCommand{Type: 0x23, Params: []byte{43, 0}}, "m", repTrain},
+		{"building morph", repCommand{Type: 0x35, Params: []byte{132, 0}}, "l", repTrain},
+		{"build", repCommand{Type: 0x0C, Params: []byte{6, 0, 0, 0, 0, 111, 0}}, "bbLC", repBuild},
+		{"stim", repCommand{Type: 0x36}, "t", repOrder},
+		{"leave game", repCommand{Type: 0x57, Params: make([]byte, 9)}, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := tt.cmd.action()
+			if a.token != tt.token || a.kind != tt.kind {
+				t.Errorf("action = %q (%s), want %q (%s)", a.token, a.kind, tt.token, tt.kind)
+			}
+		})
+	}
+}
+
+func TestRepSegments(t *testing.T) {
+	group := func(frame uint32, player, g byte) repCommand {
+		return repCommand{Frame: frame, Player: player, Type: 0x13, Params: []byte{1, g}}
+	}
+	rep := &bwReplay{Commands: []repCommand{
+		group(0, 0, 1),
+		group(5, 0, 1),  // double-tap
+		group(8, 1, 2),  // someone else
+		group(10, 0, 1), // too late to be a third tap
+		{Frame: 12, Player: 0, Type: 0x1F, Params: []byte{0, 0}},
+		{Frame: 14, Player: 0, Type: 0x13, Params: []byte{0, 4}}, // assign ends the run
+		group(20, 0, 4),
+		group(100, 0, 5), // after a pause
+	}}
+
+	var got [][]string
+	for _, seg := range rep.repSegments(0, 300*time.Millisecond) {
+		var tokens []string
+		for _, a := range seg {
+			tokens = append(tokens, a.token)
+		}
+		got = append(got, tokens)
+	}
+	want := [][]string{{"DT1", "1", "m"}, {"4"}, {"5"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("repSegments = %q, want %q", got, want)
+	}
+}
+
+func TestImport(t *testing.T) {
+	tests := []struct {
+		files  []string
+		player string
+		want   string
+	}{
+		{
+			files:  []string{"legacy.rep"},
+			player: "flash",
+			want: `# Mined from 1 replay(s) of Flash
+# seen 60 times
+Flash Micro 1-2|DT1aLC2aLC
+# seen 60 times
+Flash Macro 4|4mm
+# seen 20 times
+Flash Build|mmLCbsLC
+`,
+		},
+		{
+			files:  []string{"legacy.rep"},
+			player: "Jaedong",
+			want: `# Mined from 1 replay(s) of Jaedong
+# seen 60 times
+Jaedong Macro 5-1|5zz1RC
+`,
+		},
+		{
+			// The only human is picked without -player
+			files: []string{"modern.rep"},
+			want: `# Mined from 1 replay(s) of Bisu
+# seen 25 times
+Bisu Macro 3-1|3zd1RCSRC
+`,
+		},
+		{
+			files:  []string{"remastered.rep"},
+			player: "Light",
+			want: `# Mined from 1 replay(s) of Light
+# seen 30 times
+Light Micro|DRAGtaLCaSLCRC
+`,
+		},
+		{
+			files:  []string{"remastered.rep", "remastered.rep"},
+			player: "Soulkey",
+			want: `# Mined from 2 replay(s) of Soulkey
+# seen 60 times
+Soulkey Macro 6-2|6mm2
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.files, "+")+"/"+tt.player, func(t *testing.T) {
+			var paths []string
+			for _, f := range tt.files {
+				paths = append(paths, filepath.Join("testdata", f))
+			}
+			var out bytes.Buffer
+			if err := Import(&out, paths, tt.player, 10, 300*time.Millisecond); err != nil {
+				t.Fatalf("Import: %v", err)
+			}
+			if out.String() != tt.want {
+				t.Errorf("Import printed\n%s\nwant\n%s", out.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestImportErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		files  []string
+		player string
+		text   string
+	}{
+		{"no replays", nil, "", "no replay files given"},
+		{"two humans", []string{"legacy.rep"}, "", "choose a player with -player: Flash, Jaedong"},
+		{"unknown player", []string{"modern.rep"}, "Stork", "choose a player with -player: Bisu"},
+		{"nothing repeated", []string{"modern.rep"}, "Computer", "no repeated sequences found for Computer"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var paths []string
+			for _, f := range tt.files {
+				paths = append(paths, filepath.Join("testdata", f))
+			}
+			err := Import(io.Discard, paths, tt.player, 10, 300*time.Millisecond)
+			if err == nil || !strings.Contains(err.Error(), tt.text) {
+				t.Errorf("Import error = %v, want it to mention %q", err, tt.text)
+			}
+		})
+	}
+}
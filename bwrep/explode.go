@@ -0,0 +1,177 @@
+package bwrep
+
+import (
+	"errors"
+)
+
+// PKWARE Data Compression Library "explode", the decompressor for the
+// implode format used by pre-1.18 StarCraft replays. This follows Mark
+// Adler's blast.c: a literal/copy stream with fixed Huffman tables whose
+// codes are stored bit-inverted.
+
+var errExplode = errors.New("pkware: invalid compressed data")
+
+// Compact code length tables: each byte is (repeat-1)<<4 | bit length
+var (
+	explodeLitLen = []byte{
+		11, 124, 8, 7, 28, 7, 188, 13, 76, 4, 10, 8, 12, 10, 12, 10, 8, 23, 8,
+		9, 7, 6, 7, 8, 7, 6, 55, 8, 23, 24, 12, 11, 7, 9, 11, 12, 6, 7, 22, 5,
+		7, 24, 6, 11, 9, 6, 7, 22, 7, 11, 38, 7, 9, 8, 25, 11, 8, 11, 9, 12,
+		8, 12, 5, 38, 5, 38, 5, 11, 7, 5, 6, 21, 6, 10, 53, 8, 7, 24, 10, 27,
+		44, 253, 253, 253, 252, 252, 252, 13, 12, 45, 12, 45, 12, 61, 12, 45,
+		44, 173}
+	explodeLenLen  = []byte{2, 35, 36, 53, 38, 23}
+	explodeDistLen = []byte{2, 20, 53, 230, 247, 151, 248}
+	explodeBase    = [16]int{3, 2, 4, 5, 6, 7, 8, 9, 10, 12, 16, 24, 40, 72, 136, 264}
+	explodeExtra   = [16]uint{0, 0, 0, 0, 0, 0, 0, 0, 1, 2, 3, 4, 5, 6, 7, 8}
+)
+
+const explodeMaxBits = 13
+
+// huffman is a canonical code: count[n] codes of length n, symbols in
+// code order
+type huffman struct {
+	count  [explodeMaxBits + 1]int
+	symbol []int
+}
+
+func newHuffman(rep []byte) *huffman {
+	var lengths []int
+	for _, b := range rep {
+		for i := 0; i <= int(b>>4); i++ {
+			lengths = append(lengths, int(b&15))
+		}
+	}
+
+	h := &huffman{symbol: make([]int, len(lengths))}
+	for _, l := range lengths {
+		h.count[l]++
+	}
+	var offs [explodeMaxBits + 1]int
+	for l := 1; l < explodeMaxBits; l++ {
+		offs[l+1] = offs[l] + h.count[l]
+	}
+	for sym, l := range lengths {
+		h.symbol[offs[l]] = sym
+		offs[l]++
+	}
+	return h
+}
+
+var (
+	explodeLitCode  = newHuffman(explodeLitLen)
+	explodeLenCode  = newHuffman(explodeLenLen)
+	explodeDistCode = newHuffman(explodeDistLen)
+)
+
+// bitReader reads the input least significant bit first
+type bitReader struct {
+	in     []byte
+	pos    int
+	bitbuf uint
+	bitcnt uint
+}
+
+func (r *bitReader) bits(need uint) (int, error) {
+	for r.bitcnt < need {
+		if r.pos >= len(r.in) {
+			return 0, errExplode
+		}
+		r.bitbuf |= uint(r.in[r.pos]) << r.bitcnt
+		r.pos++
+		r.bitcnt += 8
+	}
+	val := r.bitbuf & (1<<need - 1)
+	r.bitbuf >>= need
+	r.bitcnt -= need
+	return int(val), nil
+}
+
+func (r *bitReader) decode(h *huffman) (int, error) {
+	code, first, index := 0, 0, 0
+	for l := 1; l <= explodeMaxBits; l++ {
+		bit, err := r.bits(1)
+		if err != nil {
+			return 0, err
+		}
+		code |= bit ^ 1 // codes are stored inverted
+		count := h.count[l]
+		if code < first+count {
+			return h.symbol[index+code-first], nil
+		}
+		index += count
+		first += count
+		first <<= 1
+		code <<= 1
+	}
+	return 0, errExplode
+}
+
+// explode decompresses one PKWARE DCL imploded block
+func explode(in []byte) ([]byte, error) {
+	r := &bitReader{in: in}
+	lit, err := r.bits(8)
+	if err != nil || lit > 1 {
+		return nil, errExplode
+	}
+	dict, err := r.bits(8)
+	if err != nil || dict < 4 || dict > 6 {
+		return nil, errExplode
+	}
+
+	var out []byte
+	for {
+		isCopy, err := r.bits(1)
+		if err != nil {
+			return nil, err
+		}
+
+		if isCopy == 0 {
+			var sym int
+			if lit == 1 {
+				sym, err = r.decode(explodeLitCode)
+			} else {
+				sym, err = r.bits(8)
+			}
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, byte(sym))
+			continue
+		}
+
+		sym, err := r.decode(explodeLenCode)
+		if err != nil {
+			return nil, err
+		}
+		extra, err := r.bits(explodeExtra[sym])
+		if err != nil {
+			return nil, err
+		}
+		length := explodeBase[sym] + extra
+		if length == 519 {
+			return out, nil // end code
+		}
+
+		shift := uint(dict)
+		if length == 2 {
+			shift = 2
+		}
+		sym, err = r.decode(explodeDistCode)
+		if err != nil {
+			return nil, err
+		}
+		low, err := r.bits(shift)
+		if err != nil {
+			return nil, err
+		}
+		dist := sym<<shift + low + 1
+		if dist > len(out) {
+			return nil, errExplode
+		}
+		start := len(out) - dist
+		for i := 0; i < length; i++ {
+			out = append(out, out[start+i])
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package bwrep
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestExplode(t *testing.T) {
+	tests := []struct {
+		name string
+		in   []byte
+		want string
+	}{
+		// The example from the PKWARE DCL format notes
+		{"reference", []byte{0x00, 0x04, 0x82, 0x24, 0x25, 0x8f, 0x80, 0x7f}, "AIAIAIAIAIAIA"},
+		{"end code only", []byte{0x00, 0x06, 0x01, 0xff}, ""},
+		{"coded literals", []byte{0x01, 0x04, 0x50, 0x2c, 0x50, 0x7e, 0x09, 0xf8, 0x07}, "Hi!Hi!"},
+		{"length 2 copy", []byte{0x00, 0x05, 0xc2, 0x88, 0xed, 0x05, 0xfc, 0x03}, "abab"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := explode(tt.in)
+			if err != nil {
+				t.Fatalf("explode: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("explode = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExplodeInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		in   []byte
+	}{
+		{"empty", nil},
+		{"no dictionary size", []byte{0x00}},
+		{"unknown literal mode", []byte{0x02, 0x04}},
+		{"dictionary too small", []byte{0x00, 0x03}},
+		{"dictionary too large", []byte{0x00, 0x07}},
+		{"no end code", []byte{0x00, 0x04, 0x82, 0x24}},
+		{"copy before any output", []byte{0x00, 0x04, 0x1f, 0x02, 0xfe, 0x01}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := explode(tt.in); !errors.Is(err, errExplode) {
+				t.Errorf("explode error = %v, want %v", err, errExplode)
+			}
+		})
+	}
+}
+
+// The sample replays' header chunks are imploded with long runs of zeroes
+// copied across the whole dictionary
+func TestExplodeReplayChunk(t *testing.T) {
+	r := &repReader{data: readFixture(t, "legacy.rep")}
+	if _, err := r.section(4); err != nil {
+		t.Fatal(err)
+	}
+	header, err := r.section(repHeaderSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(header[0x61:], []byte("Fighting Spirit\x00")) {
+		t.Errorf("map name = %q", header[0x61:0x61+32])
+	}
+}
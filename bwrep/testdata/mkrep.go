@@ -0,0 +1,379 @@
+//go:build ignore
+
+// mkrep writes the sample replays the bwrep tests read. They are built to
+// the .rep layout rather than recorded from a game, so what each player did
+// is known exactly:
+//
+//	go run mkrep.go
+//
+// legacy.rep is a 1.16 replay with PKWARE imploded chunks, modern.rep a
+// 1.18 replay with zlib chunks, and remastered.rep a 1.21 replay with the
+// extra section and the wider selection and order commands.
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"hash/crc32"
+	"log"
+	"math/rand"
+	"os"
+)
+
+const (
+	chunkSize  = 8192
+	headerSize = 0x279
+)
+
+type player struct {
+	id    byte
+	name  string
+	race  byte // 0 Zerg, 1 Terran, 2 Protoss
+	human bool
+}
+
+// command is one action at a frame
+type command struct {
+	frame  uint32
+	player byte
+	typ    byte
+	params []byte
+}
+
+func main() {
+	write("legacy.rep", "reRS", false, false, 0, "Fighting Spirit",
+		[]player{{0, "Flash", 1, true}, {1, "Jaedong", 0, true}}, legacyCommands())
+	write("modern.rep", "seRS", true, false, 1, "Circuit Breaker",
+		[]player{{0, "Bisu", 2, true}, {1, "Computer", 1, false}}, modernCommands())
+	write("remastered.rep", "seRS", true, true, 1, "Polypoid",
+		[]player{{0, "Light", 1, true}, {1, "Soulkey", 0, true}}, remasteredCommands())
+}
+
+func u16(v int) []byte { return binary.LittleEndian.AppendUint16(nil, uint16(v)) }
+
+func cat(parts ...[]byte) []byte { return bytes.Join(parts, nil) }
+
+func hotkey(group int) []byte { return []byte{1, byte(group)} }
+
+// order is a targeted order at a map position: x, y, target, unit type,
+// order, queued
+func order(id byte, queued bool) []byte {
+	q := byte(0)
+	if queued {
+		q = 1
+	}
+	return cat(u16(1200), u16(860), u16(0), u16(0xE4), []byte{id, q})
+}
+
+// legacyCommands has Flash double-tapping his army group, attack-moving two
+// groups and macroing marines, and Jaedong cycling larva
+func legacyCommands() []command {
+	rng := rand.New(rand.NewSource(116))
+	var cmds []command
+	at := func(f uint32, p, typ byte, params []byte) {
+		cmds = append(cmds, command{f, p, typ, params})
+	}
+	for cycle := 0; cycle < 60; cycle++ {
+		t := uint32(300 + cycle*200 + rng.Intn(20))
+
+		at(t, 0, 0x13, hotkey(1))
+		at(t+4, 0, 0x13, hotkey(1)) // double-tap centres the screen
+		at(t+10, 0, 0x15, order(14, false))
+		at(t+16, 0, 0x13, hotkey(2))
+		at(t+22, 0, 0x15, order(14, false))
+		// Assigning a group can't be trained and ends the sequence
+		at(t+30, 0, 0x13, []byte{0, 5})
+
+		m := t + 90 + uint32(rng.Intn(10))
+		at(m, 0, 0x13, hotkey(4))
+		at(m+3, 0, 0x1F, u16(0)) // marine
+		at(m+6, 0, 0x1F, u16(0))
+		if cycle%3 == 0 {
+			at(m+12, 0, 0x09, cat([]byte{1}, u16(17)))                    // click an SCV
+			at(m+16, 0, 0x0C, cat([]byte{6}, u16(40), u16(52), u16(109))) // supply depot
+		}
+
+		z := t + 50 + uint32(rng.Intn(10))
+		at(z, 1, 0x13, hotkey(5))
+		at(z+2, 1, 0x23, u16(37)) // zergling
+		at(z+4, 1, 0x23, u16(37))
+		at(z+8, 1, 0x13, hotkey(1))
+		at(z+12, 1, 0x14, cat(u16(900), u16(400), u16(0), u16(0xE4), []byte{0}))
+		// A command of unknown size skips the rest of its frame
+		at(z+14, 1, 0xEE, nil)
+		at(z+14, 1, 0x13, hotkey(9))
+	}
+	return cmds
+}
+
+// modernCommands has Bisu warping in zealots and dragoons and queueing
+// orders against a computer
+func modernCommands() []command {
+	rng := rand.New(rand.NewSource(118))
+	var cmds []command
+	at := func(f uint32, p, typ byte, params []byte) {
+		cmds = append(cmds, command{f, p, typ, params})
+	}
+	for cycle := 0; cycle < 25; cycle++ {
+		t := uint32(400 + cycle*240 + rng.Intn(30))
+
+		at(t, 0, 0x13, hotkey(3))
+		at(t+4, 0, 0x1F, u16(65)) // zealot
+		at(t+8, 0, 0x1F, u16(66)) // dragoon
+		at(t+14, 0, 0x13, hotkey(1))
+		at(t+20, 0, 0x14, cat(u16(700), u16(300), u16(0), u16(0xE4), []byte{0}))
+		at(t+24, 0, 0x14, cat(u16(760), u16(340), u16(0), u16(0xE4), []byte{1}))
+
+		at(t+100, 1, 0x13, hotkey(1))
+		at(t+104, 1, 0x15, order(14, false))
+	}
+	return cmds
+}
+
+// remasteredCommands uses the 1.21 commands: Light box-selecting, stimming
+// and queueing attack-moves, and Soulkey making mutalisks
+func remasteredCommands() []command {
+	rng := rand.New(rand.NewSource(121))
+	var cmds []command
+	at := func(f uint32, p, typ byte, params []byte) {
+		cmds = append(cmds, command{f, p, typ, params})
+	}
+	// 1.21 targeted orders carry two more bytes before the unit type
+	order121 := func(id byte, queued bool) []byte {
+		q := byte(0)
+		if queued {
+			q = 1
+		}
+		return cat(u16(1500), u16(700), u16(0), u16(0), u16(0xE4), []byte{id, q})
+	}
+	for cycle := 0; cycle < 30; cycle++ {
+		t := uint32(500 + cycle*220 + rng.Intn(25))
+
+		at(t, 0, 0x63, cat([]byte{3}, u16(12), u16(0), u16(13), u16(0), u16(14), u16(0)))
+		at(t+5, 0, 0x36, nil) // stim
+		at(t+10, 0, 0x61, order121(14, false))
+		at(t+15, 0, 0x61, order121(14, true))
+		at(t+20, 0, 0x60, cat(u16(1400), u16(650), u16(0), u16(0), u16(0xE4), []byte{0}))
+
+		at(t+80, 1, 0x13, hotkey(6))
+		at(t+83, 1, 0x23, u16(43)) // mutalisk
+		at(t+86, 1, 0x23, u16(43))
+		at(t+90, 1, 0x13, hotkey(2))
+	}
+	return cmds
+}
+
+func header(engine byte, mapName string, players []player, frames uint32) []byte {
+	h := make([]byte, headerSize)
+	h[0] = engine
+	binary.LittleEndian.PutUint32(h[0x01:], frames)
+	copy(h[0x18:], "bwrep sample")
+	copy(h[0x61:], mapName)
+	for i := 0; i < 12; i++ {
+		slot := h[0xA1+i*36 : 0xA1+(i+1)*36]
+		binary.LittleEndian.PutUint16(slot, uint16(i))
+		slot[4] = 0xFF
+		slot[9] = 6
+	}
+	for i, p := range players {
+		slot := h[0xA1+i*36 : 0xA1+(i+1)*36]
+		slot[4] = p.id
+		slot[8] = 1
+		if p.human {
+			slot[8] = 2
+		}
+		slot[9] = p.race
+		slot[10] = byte(i + 1)
+		copy(slot[11:36], p.name)
+	}
+	return h
+}
+
+// commandSection packs commands into frame blocks
+func commandSection(cmds []command) []byte {
+	var out []byte
+	for i := 0; i < len(cmds); {
+		j := i
+		var block []byte
+		for ; j < len(cmds) && cmds[j].frame == cmds[i].frame; j++ {
+			block = append(block, cmds[j].player, cmds[j].typ)
+			block = append(block, cmds[j].params...)
+		}
+		out = binary.LittleEndian.AppendUint32(out, cmds[i].frame)
+		out = append(out, byte(len(block)))
+		out = append(out, block...)
+		i = j
+	}
+	return out
+}
+
+// sortByFrame orders commands by frame, keeping each player's own order
+func sortByFrame(cmds []command) {
+	for i := 1; i < len(cmds); i++ {
+		for j := i; j > 0 && cmds[j].frame < cmds[j-1].frame; j-- {
+			cmds[j], cmds[j-1] = cmds[j-1], cmds[j]
+		}
+	}
+}
+
+func write(path, id string, modern, extra bool, engine byte, mapName string, players []player, cmds []command) {
+	sortByFrame(cmds)
+	frames := cmds[len(cmds)-1].frame + 24
+
+	var out []byte
+	section := func(data []byte) {
+		out = binary.LittleEndian.AppendUint32(out, crc32.ChecksumIEEE(data))
+		var chunks [][]byte
+		for start := 0; start < len(data); start += chunkSize {
+			raw := data[start:min(start+chunkSize, len(data))]
+			chunk := raw
+			if packed := compress(raw, modern); len(packed) < len(raw) {
+				chunk = packed
+			}
+			chunks = append(chunks, chunk)
+		}
+		out = binary.LittleEndian.AppendUint32(out, uint32(len(chunks)))
+		for _, c := range chunks {
+			out = binary.LittleEndian.AppendUint32(out, uint32(len(c)))
+			out = append(out, c...)
+		}
+	}
+
+	section([]byte(id))
+	if extra {
+		section([]byte{0x04, 0x00, 0x00, 0x00})
+	}
+	section(header(engine, mapName, players, frames))
+	body := commandSection(cmds)
+	section(binary.LittleEndian.AppendUint32(nil, uint32(len(body))))
+	section(body)
+
+	if err := os.WriteFile(path, out, 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func compress(data []byte, modern bool) []byte {
+	if !modern {
+		return implode(data)
+	}
+	var b bytes.Buffer
+	zw := zlib.NewWriter(&b)
+	zw.Write(data)
+	zw.Close()
+	return b.Bytes()
+}
+
+// The implode side of the PKWARE DCL format, with literals stored as plain
+// bytes and a 4KB dictionary. Tables match explode.go.
+var (
+	lenLen  = []byte{2, 35, 36, 53, 38, 23}
+	distLen = []byte{2, 20, 53, 230, 247, 151, 248}
+	base    = [16]int{3, 2, 4, 5, 6, 7, 8, 9, 10, 12, 16, 24, 40, 72, 136, 264}
+	extra   = [16]uint{0, 0, 0, 0, 0, 0, 0, 0, 1, 2, 3, 4, 5, 6, 7, 8}
+)
+
+type code struct{ bits, len int }
+
+// canonical assigns the codes explode's decoder expects to each symbol
+func canonical(rep []byte) []code {
+	var lengths []int
+	for _, b := range rep {
+		for i := 0; i <= int(b>>4); i++ {
+			lengths = append(lengths, int(b&15))
+		}
+	}
+	var count [14]int
+	for _, l := range lengths {
+		count[l]++
+	}
+	var next [14]int
+	c := 0
+	for l := 1; l < 14; l++ {
+		next[l] = c
+		c = (c + count[l]) << 1
+	}
+	codes := make([]code, len(lengths))
+	for sym, l := range lengths {
+		codes[sym] = code{next[l], l}
+		next[l]++
+	}
+	return codes
+}
+
+type bitWriter struct {
+	out    []byte
+	bitbuf uint
+	bitcnt uint
+}
+
+func (w *bitWriter) bits(v int, n uint) {
+	w.bitbuf |= uint(v) << w.bitcnt
+	w.bitcnt += n
+	for w.bitcnt >= 8 {
+		w.out = append(w.out, byte(w.bitbuf))
+		w.bitbuf >>= 8
+		w.bitcnt -= 8
+	}
+}
+
+// code writes a Huffman code most significant bit first, inverted
+func (w *bitWriter) code(c code) {
+	for i := c.len - 1; i >= 0; i-- {
+		w.bits((c.bits>>i)&1^1, 1)
+	}
+}
+
+func (w *bitWriter) copy(length, dist int) {
+	lenCodes, distCodes := canonical(lenLen), canonical(distLen)
+	sym := 0
+	for s := range base {
+		if base[s] <= length && length < base[s]+1<<extra[s] {
+			sym = s
+		}
+	}
+	w.bits(1, 1)
+	w.code(lenCodes[sym])
+	w.bits(length-base[sym], extra[sym])
+	if length == 519 {
+		return
+	}
+	shift := uint(6)
+	if length == 2 {
+		shift = 2
+	}
+	w.code(distCodes[(dist-1)>>shift])
+	w.bits((dist-1)&(1<<shift-1), shift)
+}
+
+func implode(data []byte) []byte {
+	w := &bitWriter{}
+	w.bits(0, 8) // literals as plain bytes
+	w.bits(6, 8) // 4KB dictionary
+	for i := 0; i < len(data); {
+		bestLen, bestDist := 0, 0
+		for dist := 1; dist <= min(i, 4096); dist++ {
+			n := 0
+			for n < 518 && i+n < len(data) && data[i+n] == data[i+n-dist] {
+				n++
+			}
+			if n > bestLen && (n > 2 || dist <= 256) {
+				bestLen, bestDist = n, dist
+			}
+		}
+		if bestLen >= 2 {
+			w.copy(bestLen, bestDist)
+			i += bestLen
+			continue
+		}
+		w.bits(0, 1)
+		w.bits(int(data[i]), 8)
+		i++
+	}
+	w.copy(519, 0)
+	if w.bitcnt > 0 {
+		w.bits(0, 8-w.bitcnt)
+	}
+	return w.out
+}
@@ -0,0 +1,186 @@
+// Command leaderboard is a small self-hostable server that keeps a team's
+// best times per pattern. Trainers submit scores with POST /scores and read
+// rankings with GET /rankings?hash=...
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// score is one player's best time on one pattern
+type score struct {
+	Hash    string    `json:"hash"` // identifies the pattern across trainers
+	Name    string    `json:"name"`
+	Player  string    `json:"player,omitempty"`
+	Profile string    `json:"profile"`
+	BestMs  int64     `json:"best_ms"`
+	At      time.Time `json:"at"`
+}
+
+// who is the player a score belongs to. Trainers from before player names
+// sent only their profile.
+func (sc score) who() string {
+	if sc.Player != "" {
+		return sc.Player
+	}
+	return sc.Profile
+}
+
+// store keeps the best score per pattern and player in a JSON file
+type store struct {
+	mu     sync.Mutex
+	path   string
+	Scores map[string]map[string]*score `json:"scores"` // hash -> player -> best
+}
+
+func loadStore(path string) *store {
+	s := &store{path: path, Scores: make(map[string]map[string]*score)}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return s
+	}
+	if err := json.Unmarshal(data, s); err != nil {
+		log.Printf("%s: %v, starting empty", path, err)
+	}
+	if s.Scores == nil {
+		s.Scores = make(map[string]map[string]*score)
+	}
+	return s
+}
+
+// saveLocked writes the store; callers hold s.mu
+func (s *store) saveLocked() error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// submit records scores that beat the player's stored best
+func (s *store) submit(scores []score) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	changed := false
+	for _, sc := range scores {
+		byPlayer, ok := s.Scores[sc.Hash]
+		if !ok {
+			byPlayer = make(map[string]*score)
+			s.Scores[sc.Hash] = byPlayer
+		}
+		if best, ok := byPlayer[sc.who()]; ok && best.BestMs <= sc.BestMs {
+			continue
+		}
+		byPlayer[sc.who()] = &sc
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+	return s.saveLocked()
+}
+
+// rankings returns each requested pattern's scores, fastest first
+func (s *store) rankings(hashes []string) map[string][]score {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := make(map[string][]score)
+	for _, hash := range hashes {
+		var list []score
+		for _, sc := range s.Scores[hash] {
+			list = append(list, *sc)
+		}
+		sort.Slice(list, func(i, j int) bool {
+			if list[i].BestMs != list[j].BestMs {
+				return list[i].BestMs < list[j].BestMs
+			}
+			return list[i].who() < list[j].who()
+		})
+		result[hash] = list
+	}
+	return result
+}
+
+// submitResult tells a trainer how many of its scores were kept and which
+// ones weren't
+type submitResult struct {
+	Accepted int             `json:"accepted"`
+	Rejected []rejectedScore `json:"rejected,omitempty"`
+}
+
+// rejectedScore is a submitted score that was skipped, by its position in
+// the request
+type rejectedScore struct {
+	Index int    `json:"index"`
+	Error string `json:"error"`
+}
+
+func (s *store) handleScores(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "POST only", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var scores []score
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&scores); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// A bad score is skipped on its own, so it can't hold up the rest
+	var result submitResult
+	var valid []score
+	for i, sc := range scores {
+		if sc.Hash == "" || sc.who() == "" || sc.BestMs <= 0 {
+			result.Rejected = append(result.Rejected, rejectedScore{i, "needs a hash, player and positive best_ms"})
+			continue
+		}
+		valid = append(valid, sc)
+	}
+	result.Accepted = len(valid)
+
+	if err := s.submit(valid); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(result.Rejected) > 0 {
+		log.Printf("rejected %d of %d scores from %s", len(result.Rejected), len(scores), r.RemoteAddr)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+func (s *store) handleRankings(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "GET only", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.rankings(r.URL.Query()["hash"]))
+}
+
+func main() {
+	addr := flag.String("addr", ":8080", "address to listen on")
+	data := flag.String("data", "leaderboard.json", "file the scores are kept in")
+	flag.Parse()
+
+	s := loadStore(*data)
+	http.HandleFunc("/scores", s.handleScores)
+	http.HandleFunc("/rankings", s.handleRankings)
+
+	log.Printf("leaderboard listening on %s, scores in %s", *addr, *data)
+	log.Fatal(http.ListenAndServe(*addr, nil))
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"time"
+)
+
+// dailyPatterns is how many patterns the daily challenge draws
+const dailyPatterns = 10
+
+// DailyStats is a profile's daily challenge record
+type DailyStats struct {
+	History    []DailyScore `json:"history"`
+	Streak     int          `json:"streak"` // challenges completed on days in a row, up to the last one
+	BestStreak int          `json:"best_streak"`
+}
+
+// DailyScore is one day's scored attempt
+type DailyScore struct {
+	Date      string        `json:"date"` // UTC, 2006-01-02
+	Perfect   int           `json:"perfect"`
+	Total     int           `json:"total"`
+	Time      time.Duration `json:"time"` // patterns' times added up
+	Completed bool          `json:"completed"`
+}
+
+// dailyRun is the daily challenge being played
+type dailyRun struct {
+	date   string
+	time   time.Duration
+	streak int // streak the attempt can extend
+}
+
+// dailyDate is the challenge day a moment falls in. Days are UTC so the
+// whole team shares them.
+func dailyDate(t time.Time) string {
+	return t.UTC().Format("2006-01-02")
+}
+
+// dailySeed derives the day's seed, which fixes its patterns and order
+func dailySeed(date string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte("daily " + date))
+	return int64(h.Sum64())
+}
+
+// dailyQueue is the day's patterns, drawn from the built-in templates so
+// everyone gets the same ones whatever their files hold
+func (app *App) dailyQueue() []Pattern {
+	return generatePatterns(defaultTemplates, dailyPatterns, app.rng)
+}
+
+func (s *AllStats) dailyStats(profile string) *DailyStats {
+	if s.Daily == nil {
+		s.Daily = make(map[string]*DailyStats)
+	}
+	if s.Daily[profile] == nil {
+		s.Daily[profile] = &DailyStats{}
+	}
+	return s.Daily[profile]
+}
+
+// score returns the attempt made on a day, or nil
+func (ds *DailyStats) score(date string) *DailyScore {
+	for i := len(ds.History) - 1; i >= 0; i-- {
+		if ds.History[i].Date == date {
+			return &ds.History[i]
+		}
+	}
+	return nil
+}
+
+// streak is the streak still alive on a day: it runs out once a day passes
+// without a completed challenge
+func (ds *DailyStats) streak(date string) int {
+	if len(ds.History) == 0 {
+		return 0
+	}
+	last := ds.History[len(ds.History)-1].Date
+	if last == date || last == previousDay(date) {
+		return ds.Streak
+	}
+	return 0
+}
+
+func previousDay(date string) string {
+	day, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return ""
+	}
+	return day.AddDate(0, 0, -1).Format("2006-01-02")
+}
+
+// begin records a day's attempt as not completed before it is played, so
+// quitting part way through still uses it up and breaks the streak. It
+// returns the streak a completed attempt extends.
+func (ds *DailyStats) begin(date string) int {
+	streak := ds.streak(date)
+	ds.History = append(ds.History, DailyScore{Date: date, Total: dailyPatterns})
+	ds.Streak = 0
+	return streak
+}
+
+// finish fills in the day's attempt with its score
+func (ds *DailyStats) finish(score DailyScore, streak int) {
+	ds.Streak = 0
+	if score.Completed {
+		ds.Streak = streak + 1
+	}
+	ds.BestStreak = max(ds.BestStreak, ds.Streak)
+	if attempt := ds.score(score.Date); attempt != nil {
+		*attempt = score
+	} else {
+		ds.History = append(ds.History, score)
+	}
+}
+
+func (s DailyScore) String() string {
+	return fmt.Sprintf("%d/%d perfect in %.1fs", s.Perfect, s.Total, s.Time.Seconds())
+}
+
+// startDaily starts today's challenge, unless this profile has had its
+// attempt already
+func (app *App) startDaily() {
+	if app.race != nil {
+		return
+	}
+	date := dailyDate(time.Now())
+	ds := app.stats.dailyStats(app.settings.profileName())
+	if score := ds.score(date); score != nil {
+		app.statusLabel.Text = fmt.Sprintf("📅 Today's challenge is done: %s • New one tomorrow", score)
+		app.statusLabel.Color = app.palette.Info
+		app.statusLabel.Refresh()
+		return
+	}
+	app.daily = &dailyRun{date: date, streak: ds.begin(date)}
+	app.stats.save()
+	app.launchSession(dailySeed(date))
+}
+
+// addDailyTime counts a finished pattern's time towards the day's score
+func (app *App) addDailyTime(elapsed time.Duration) {
+	if app.daily != nil {
+		app.daily.time += elapsed
+	}
+}
+
+// finishDaily scores the challenge when its session ends, finished or
+// not
+func (app *App) finishDaily(completed bool) {
+	run := app.daily
+	if run == nil {
+		return
+	}
+	app.daily = nil
+
+	ds := app.stats.dailyStats(app.settings.profileName())
+	score := DailyScore{
+		Date:      run.date,
+		Perfect:   app.sessionPerfect,
+		Total:     dailyPatterns,
+		Time:      run.time,
+		Completed: completed,
+	}
+	ds.finish(score, run.streak)
+	app.stats.save()
+
+	app.patternName.Text = "📅 Daily challenge " + run.date
+	app.patternName.Color = app.palette.Best
+	app.patternName.Refresh()
+
+	app.statusLabel.Text = score.String()
+	if ds.Streak > 1 {
+		app.statusLabel.Text += fmt.Sprintf(" • 🔥 %d-day streak", ds.Streak)
+	}
+	app.statusLabel.Color = app.palette.Success
+	if !completed {
+		app.statusLabel.Text += " • stopped early"
+		app.statusLabel.Color = app.palette.Ended
+	}
+	app.statusLabel.Refresh()
+
+	app.hintLabel.Text = "Come back tomorrow for a new challenge • SPACE to train"
+	app.hintLabel.Refresh()
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// doubleTokens maps each double token to the single input it is made of
+var doubleTokens = map[string]string{
+	"DLC": "LC",
+	"DT1": "1",
+	"DT2": "2",
+	"DT3": "3",
+	"DT4": "4",
+	"DT5": "5",
+	"DT6": "6",
+	"DT7": "7",
+	"DT8": "8",
+	"DT9": "9",
+	"DT0": "0",
+}
+
+// expectedSingleClick is the click the grid should accept next; a double
+// click is entered as two single clicks on the same cell
+func (app *App) expectedSingleClick() string {
+	if single, ok := doubleTokens[app.expectedClick]; ok {
+		return single
+	}
+	return app.expectedClick
+}
+
+// collectDouble folds two identical inputs that arrive within the double
+// interval into their double token. It reports false while the first half
+// is waiting for its partner.
+func (app *App) collectDouble(key string) (string, bool) {
+	input := strings.Join(app.inputBuffer, "")
+	expected := getExpectedKey(app.currentPattern.Pattern, len(input))
+	single, ok := doubleTokens[expected]
+	if !ok || key != single {
+		app.pendingDouble = time.Time{}
+		return key, true
+	}
+
+	if app.pendingDouble.IsZero() {
+		app.pendingDouble = app.now()
+		app.lastOutcome = "half"
+		// Start timer on first valid keystroke
+		if app.startTime.IsZero() {
+			app.startTime = app.pendingDouble
+		}
+		app.inputDisplay.Text = formatForDisplay(input) + "·"
+		app.inputDisplay.Color = app.palette.Pending
+		app.inputDisplay.Refresh()
+		return key, false
+	}
+
+	gap := app.now().Sub(app.pendingDouble)
+	app.pendingDouble = time.Time{}
+	if gap > app.settings.doubleInterval() {
+		app.rejectInput(expected, key+" too slow", fmt.Sprintf("Too slow for %s (%v)", formatForDisplay(expected), gap.Round(time.Millisecond)))
+		return key, false
+	}
+	return expected, true
+}
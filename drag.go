@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+
+	"fyne.io/fyne/v2"
+)
+
+// dragMinCoverage is the box overlap needed for a DRAG token to count
+const dragMinCoverage = 0.6
+
+// dragTarget is a rectangle of grid cells the player must box-select
+type dragTarget struct {
+	col, row, w, h int
+}
+
+// randomDragTarget picks a 2x2 to 3x3 block somewhere in the 4x4 grid
+func randomDragTarget(rng *rand.Rand) dragTarget {
+	w := 2 + rng.Intn(2)
+	h := 2 + rng.Intn(2)
+	return dragTarget{col: rng.Intn(5 - w), row: rng.Intn(5 - h), w: w, h: h}
+}
+
+func (t dragTarget) contains(cell int) bool {
+	col, row := cell%4, cell/4
+	return col >= t.col && col < t.col+t.w && row >= t.row && row < t.row+t.h
+}
+
+// dragTargetBounds returns the absolute top-left and bottom-right corners of the target
+func (app *App) dragTargetBounds() (fyne.Position, fyne.Position) {
+	driver := fyne.CurrentApp().Driver()
+	first := app.gridCells[app.dragTarget.row*4+app.dragTarget.col]
+	last := app.gridCells[(app.dragTarget.row+app.dragTarget.h-1)*4+app.dragTarget.col+app.dragTarget.w-1]
+	topLeft := driver.AbsolutePositionForObject(first)
+	bottomRight := driver.AbsolutePositionForObject(last).Add(last.Size())
+	return topLeft, bottomRight
+}
+
+// boxCoverage scores a selection box against the target as intersection over union
+func boxCoverage(a1, a2, b1, b2 fyne.Position) float32 {
+	w := min(a2.X, b2.X) - max(a1.X, b1.X)
+	h := min(a2.Y, b2.Y) - max(a1.Y, b1.Y)
+	if w <= 0 || h <= 0 {
+		return 0
+	}
+	inter := w * h
+	union := (a2.X-a1.X)*(a2.Y-a1.Y) + (b2.X-b1.X)*(b2.Y-b1.Y) - inter
+	return inter / union
+}
+
+func (app *App) showDragTarget() {
+	app.dragTarget = randomDragTarget(app.rng)
+	app.activeCell = -1
+	app.expectedClick = "DRAG"
+	for i := 0; i < 16; i++ {
+		if app.dragTarget.contains(i) {
+			app.clickGrid[i].FillColor = app.palette.DragTarget
+			app.clickGrid[i].Refresh()
+		}
+	}
+	corner := app.dragTarget.row*4 + app.dragTarget.col
+	app.clickGridTexts[corner].Text = "▣"
+	app.clickGridTexts[corner].Refresh()
+}
+
+func (app *App) beginDrag(abs fyne.Position) {
+	app.dragStart = abs
+	app.dragArmed = true
+	app.dragMoved = false
+}
+
+func (app *App) updateDrag(abs fyne.Position) {
+	if !app.dragArmed {
+		return
+	}
+	app.dragMoved = true
+
+	topLeft := fyne.NewPos(min(app.dragStart.X, abs.X), min(app.dragStart.Y, abs.Y))
+	bottomRight := fyne.NewPos(max(app.dragStart.X, abs.X), max(app.dragStart.Y, abs.Y))
+	origin := fyne.CurrentApp().Driver().AbsolutePositionForObject(app.dragLayer)
+
+	app.dragBox.Move(topLeft.Subtract(origin))
+	app.dragBox.Resize(fyne.NewSize(bottomRight.X-topLeft.X, bottomRight.Y-topLeft.Y))
+	app.dragBox.Show()
+	app.dragBox.Refresh()
+}
+
+func (app *App) endDrag() {
+	if !app.dragArmed || !app.dragMoved {
+		return
+	}
+	app.dragArmed = false
+	app.dragBox.Hide()
+
+	boxStart := app.dragBox.Position()
+	origin := fyne.CurrentApp().Driver().AbsolutePositionForObject(app.dragLayer)
+	boxMin := origin.Add(boxStart)
+	boxMax := boxMin.Add(app.dragBox.Size())
+	targetMin, targetMax := app.dragTargetBounds()
+	app.scoreDrag(boxCoverage(boxMin, boxMax, targetMin, targetMax))
+}
+
+// scoreDrag accepts or rejects a finished box by its coverage of the target
+func (app *App) scoreDrag(coverage float32) {
+	app.lastOutcome = ""
+	if coverage < dragMinCoverage {
+		app.registerGridMistake("DRAG", fmt.Sprintf("loose box (%.0f%%)", coverage*100))
+	} else {
+		app.stats.recordDrag(app.currentPattern, float64(coverage))
+
+		// Set before addKey so a pattern-finishing drag keeps its result message
+		app.statusLabel.Text = fmt.Sprintf("▣ %.0f%% box", coverage*100)
+		app.statusLabel.Color = app.palette.Success
+		app.statusLabel.Refresh()
+
+		app.addKey("DRAG")
+	}
+	app.record(replayEvent{Kind: "drag", Coverage: coverage, Cell: -1})
+}
+
+// dragMiss handles a plain click where a box-drag was expected
+func (app *App) dragMiss() {
+	app.lastOutcome = ""
+	app.dragArmed = false
+	app.registerGridMistake("LC", "click instead of drag")
+	app.record(replayEvent{Kind: "dragmiss", Cell: -1})
+}
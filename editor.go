@@ -0,0 +1,543 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"image/color"
+	"os"
+	"strings"
+	"time"
+	"unicode"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/driver/desktop"
+	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/widget"
+)
+
+// editorItem is a pattern in the editor and where it came from in the file
+type editorItem struct {
+	pattern Pattern
+	origin  int // index among the file's patterns, or -1 if added
+}
+
+// patternsDoc is the patterns file split into its patterns and the comment
+// and blank lines above each, so saving can rewrite it without losing them
+type patternsDoc struct {
+	patterns []Pattern
+	above    [][]string
+	trailing []string
+}
+
+func readPatternsDoc(path string) *patternsDoc {
+	doc := &patternsDoc{}
+	file, err := os.Open(path)
+	if err != nil {
+		return doc
+	}
+	defer file.Close()
+
+	var pending []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		raw := scanner.Text()
+		line := strings.TrimSpace(raw)
+		if line == "" || strings.HasPrefix(line, "#") {
+			pending = append(pending, raw)
+			continue
+		}
+		doc.patterns = append(doc.patterns, parsePatternLine(line))
+		doc.above = append(doc.above, pending)
+		pending = nil
+	}
+	doc.trailing = pending
+	return doc
+}
+
+// write saves the items in order, each under the lines that were above it.
+// Lines above a deleted pattern move down to the next pattern that's kept.
+func (doc *patternsDoc) write(path string, items []*editorItem) error {
+	kept := make([]bool, len(doc.patterns))
+	for _, item := range items {
+		if item.origin >= 0 {
+			kept[item.origin] = true
+		}
+	}
+	above := make([][]string, len(doc.patterns))
+	var carried []string
+	for i := range doc.patterns {
+		lines := append(carried, doc.above[i]...)
+		carried = nil
+		if kept[i] {
+			above[i] = lines
+		} else {
+			carried = lines
+		}
+	}
+
+	var b strings.Builder
+	for _, item := range items {
+		if item.origin >= 0 {
+			for _, line := range above[item.origin] {
+				b.WriteString(line + "\n")
+			}
+		}
+		b.WriteString(patternLine(item.pattern) + "\n")
+	}
+	for _, line := range append(carried, doc.trailing...) {
+		b.WriteString(line + "\n")
+	}
+	return os.WriteFile(path, []byte(b.String()), 0644)
+}
+
+// patternProblems lists what would stop a pattern from being trained or
+// saved
+func patternProblems(p Pattern) []string {
+	var problems []string
+	if strings.TrimSpace(p.Name) == "" {
+		problems = append(problems, "Needs a name")
+	}
+	if strings.Contains(p.Name, "|") || strings.Contains(p.Pattern, "|") {
+		problems = append(problems, "Can't contain |")
+	}
+	if p.Pattern == "" {
+		problems = append(problems, "Needs keys")
+		return problems
+	}
+	if strings.ContainsAny(p.Pattern, " \t") {
+		problems = append(problems, "Spaces are written SPACE")
+	}
+	// Any character a key can type matches as itself, shifted ones included
+	for _, r := range p.Pattern {
+		if r != ' ' && r != '\t' && !unicode.IsPrint(r) {
+			problems = append(problems, fmt.Sprintf("Can't type %q", r))
+		}
+	}
+	return problems
+}
+
+// editor is the pattern editor window
+type editor struct {
+	app    *App
+	window fyne.Window
+	path   string
+	doc    *patternsDoc
+	items  []*editorItem
+	chosen int // selected item, or -1
+
+	list     *widget.List
+	name     *widget.Entry
+	keys     *widget.Entry
+	preview  *canvas.Text
+	problems *canvas.Text
+	status   *canvas.Text
+	record   *widget.Button
+	recorder *keyRecorder
+	loading  bool // set while the form is filled from the selection
+}
+
+// openEditor shows the pattern editor, or brings it forward if it's open
+func (app *App) openEditor() {
+	if app.editor != nil {
+		app.editor.window.RequestFocus()
+		return
+	}
+
+	_, path := locatePatterns()
+	ed := &editor{
+		app:    app,
+		window: fyne.CurrentApp().NewWindow("✎ Pattern Editor"),
+		path:   path,
+		doc:    readPatternsDoc(path),
+		chosen: -1,
+	}
+	// Edit what's in the file, not what's in play, which can differ. With
+	// no file yet the defaults are offered as new patterns.
+	for i, p := range ed.doc.patterns {
+		ed.items = append(ed.items, &editorItem{pattern: p, origin: i})
+	}
+	if len(ed.items) == 0 {
+		for _, p := range defaultPatterns {
+			ed.items = append(ed.items, &editorItem{pattern: p, origin: -1})
+		}
+	}
+
+	ed.setupUI()
+	ed.window.SetOnClosed(func() { app.editor = nil })
+	app.editor = ed
+	ed.window.Resize(fyne.NewSize(820, 460))
+	ed.window.Show()
+	if len(ed.items) > 0 {
+		ed.list.Select(0)
+	}
+}
+
+func (ed *editor) setupUI() {
+	ed.list = widget.NewList(
+		func() int { return len(ed.items) },
+		func() fyne.CanvasObject { return widget.NewLabel("") },
+		func(id widget.ListItemID, obj fyne.CanvasObject) {
+			p := ed.items[id].pattern
+			text := fmt.Sprintf("%s   %s", p.Name, formatForDisplay(p.Pattern))
+			if len(patternProblems(p)) > 0 {
+				text = "⚠ " + text
+			}
+			obj.(*widget.Label).SetText(text)
+		},
+	)
+	ed.list.OnSelected = ed.choose
+
+	ed.name = widget.NewEntry()
+	ed.name.SetPlaceHolder("Pattern name")
+	ed.name.OnChanged = func(s string) {
+		if item := ed.current(); item != nil && !ed.loading {
+			item.pattern.Name = s
+			ed.changed()
+		}
+	}
+	ed.keys = widget.NewEntry()
+	ed.keys.SetPlaceHolder("Keys, e.g. 1a2aLC")
+	ed.keys.OnChanged = func(s string) {
+		if item := ed.current(); item != nil && !ed.loading {
+			item.pattern.Pattern = s
+			ed.changed()
+		}
+	}
+
+	ed.preview = canvas.NewText("", ed.app.palette.Text)
+	ed.preview.TextSize = 32
+	ed.preview.TextStyle = fyne.TextStyle{Monospace: true, Bold: true}
+	ed.problems = canvas.NewText("", ed.app.palette.Error)
+	ed.problems.TextSize = 14
+	ed.status = canvas.NewText("", ed.app.palette.Muted)
+	ed.status.TextSize = 14
+
+	ed.recorder = newKeyRecorder(ed)
+	ed.record = widget.NewButton("⏺ Record", ed.toggleRecording)
+	undo := widget.NewButton("⌫ Undo", ed.undoToken)
+
+	buttons := container.NewHBox(
+		widget.NewButton("+ New", ed.add),
+		widget.NewButton("− Delete", ed.remove),
+		widget.NewButton("▲", func() { ed.move(-1) }),
+		widget.NewButton("▼", func() { ed.move(1) }),
+	)
+	left := container.NewBorder(nil, buttons, nil, nil, ed.list)
+
+	form := container.NewVBox(
+		widget.NewForm(
+			widget.NewFormItem("Name", ed.name),
+			widget.NewFormItem("Keys", ed.keys),
+		),
+		container.NewBorder(nil, nil, ed.record, undo, ed.recorder),
+		container.NewCenter(ed.preview),
+		container.NewCenter(ed.problems),
+		layout.NewSpacer(),
+		container.NewBorder(nil, nil, nil, widget.NewButton("💾 Save", ed.save), container.NewCenter(ed.status)),
+	)
+
+	split := container.NewHSplit(left, container.NewPadded(form))
+	split.Offset = 0.4
+	ed.window.SetContent(split)
+}
+
+func (ed *editor) current() *editorItem {
+	if ed.chosen < 0 || ed.chosen >= len(ed.items) {
+		return nil
+	}
+	return ed.items[ed.chosen]
+}
+
+// choose fills the form from the selected pattern
+func (ed *editor) choose(id widget.ListItemID) {
+	ed.chosen = id
+	var p Pattern
+	if item := ed.current(); item != nil {
+		p = item.pattern
+	}
+	ed.loading = true
+	ed.name.SetText(p.Name)
+	ed.keys.SetText(p.Pattern)
+	ed.loading = false
+	ed.showPreview()
+}
+
+// changed redraws the list line and preview after an edit
+func (ed *editor) changed() {
+	if ed.current() != nil {
+		ed.list.RefreshItem(ed.chosen)
+	}
+	ed.showPreview()
+	ed.status.Text = "Unsaved changes"
+	ed.status.Color = ed.app.palette.Caution
+	ed.status.Refresh()
+}
+
+func (ed *editor) showPreview() {
+	item := ed.current()
+	if item == nil {
+		ed.preview.Text = ""
+		ed.problems.Text = ""
+	} else {
+		ed.preview.Text = formatForDisplay(item.pattern.Pattern)
+		problems := patternProblems(item.pattern)
+		for _, other := range ed.items {
+			if other != item && other.pattern.key() == item.pattern.key() {
+				problems = append(problems, fmt.Sprintf("Same ID as %q, so they would share stats", other.pattern.Name))
+				break
+			}
+		}
+		ed.problems.Text = strings.Join(problems, " • ")
+	}
+	ed.preview.Refresh()
+	ed.problems.Refresh()
+}
+
+// add inserts a new pattern below the selected one
+func (ed *editor) add() {
+	at := len(ed.items)
+	if ed.chosen >= 0 {
+		at = ed.chosen + 1
+	}
+	item := &editorItem{pattern: Pattern{Name: "New Pattern"}, origin: -1}
+	ed.items = append(ed.items[:at], append([]*editorItem{item}, ed.items[at:]...)...)
+	ed.list.Refresh()
+	ed.list.Select(at)
+	ed.changed()
+	ed.window.Canvas().Focus(ed.name)
+}
+
+func (ed *editor) remove() {
+	if ed.current() == nil {
+		return
+	}
+	ed.items = append(ed.items[:ed.chosen], ed.items[ed.chosen+1:]...)
+	next := min(ed.chosen, len(ed.items)-1)
+	ed.list.UnselectAll()
+	ed.chosen = -1
+	ed.list.Refresh()
+	if next >= 0 {
+		ed.list.Select(next)
+	} else {
+		ed.choose(-1)
+	}
+	ed.changed()
+}
+
+// move swaps the selected pattern with its neighbour
+func (ed *editor) move(by int) {
+	to := ed.chosen + by
+	if ed.current() == nil || to < 0 || to >= len(ed.items) {
+		return
+	}
+	ed.items[ed.chosen], ed.items[to] = ed.items[to], ed.items[ed.chosen]
+	ed.list.Refresh()
+	ed.list.Select(to)
+	ed.changed()
+}
+
+// save writes the patterns back to the file they came from and trains on
+// them from the next session
+func (ed *editor) save() {
+	for i, item := range ed.items {
+		if len(patternProblems(item.pattern)) > 0 {
+			ed.list.Select(i)
+			ed.setStatus(fmt.Sprintf("Fix %q before saving", item.pattern.Name), ed.app.palette.Error)
+			return
+		}
+	}
+	if len(ed.items) == 0 {
+		ed.setStatus("Keep at least one pattern", ed.app.palette.Error)
+		return
+	}
+
+	// New patterns take their ID from the keys they were saved with
+	patterns := make([]Pattern, len(ed.items))
+	for i, item := range ed.items {
+		item.pattern.ID = item.pattern.key()
+		patterns[i] = item.pattern
+	}
+	if err := ed.doc.write(ed.path, ed.items); err != nil {
+		ed.setStatus("❌ "+err.Error(), ed.app.palette.Error)
+		return
+	}
+
+	// Reread so comments and origins match what's now on disk
+	ed.doc = readPatternsDoc(ed.path)
+	for i, item := range ed.items {
+		item.origin = i
+	}
+	ed.app.allPatterns = patterns
+	ed.app.leaderboard.track(patterns)
+	if !ed.app.inSession {
+		ed.app.showIdleState()
+	}
+	ed.setStatus(fmt.Sprintf("Saved %d patterns to %s", len(patterns), ed.path), ed.app.palette.Success)
+}
+
+func (ed *editor) setStatus(text string, c color.Color) {
+	ed.status.Text = text
+	ed.status.Color = c
+	ed.status.Refresh()
+}
+
+func (ed *editor) toggleRecording() {
+	if ed.recorder.recording {
+		ed.stopRecording()
+		return
+	}
+	if ed.current() == nil {
+		ed.add()
+	}
+	ed.recorder.recording = true
+	ed.recorder.last = ""
+	ed.record.SetText("⏹ Stop")
+	ed.recorder.refresh()
+	ed.window.Canvas().Focus(ed.recorder)
+}
+
+func (ed *editor) stopRecording() {
+	ed.recorder.recording = false
+	ed.record.SetText("⏺ Record")
+	ed.recorder.refresh()
+}
+
+// appendToken adds a recorded token to the selected pattern's keys
+func (ed *editor) appendToken(token string) {
+	ed.keys.SetText(ed.keys.Text + token)
+}
+
+// undoToken drops the last token from the selected pattern's keys
+func (ed *editor) undoToken() {
+	tokens := splitTokens(ed.keys.Text)
+	if len(tokens) == 0 {
+		return
+	}
+	ed.keys.SetText(strings.Join(tokens[:len(tokens)-1], ""))
+}
+
+// keyRecorder captures keys and clicks into the selected pattern while
+// recording. It takes focus so the entries don't see the keys.
+type keyRecorder struct {
+	widget.BaseWidget
+	editor    *editor
+	box       *canvas.Rectangle
+	label     *canvas.Text
+	recording bool
+	focused   bool
+	numpadKey string
+
+	// last recorded token and when, to fold double taps
+	last   string
+	lastAt time.Time
+}
+
+func newKeyRecorder(ed *editor) *keyRecorder {
+	r := &keyRecorder{
+		editor: ed,
+		box:    canvas.NewRectangle(ed.app.palette.Panel),
+		label:  canvas.NewText("", ed.app.palette.Muted),
+	}
+	r.box.StrokeWidth = 2
+	r.box.SetMinSize(fyne.NewSize(200, 48))
+	r.ExtendBaseWidget(r)
+	r.refresh()
+	return r
+}
+
+func (r *keyRecorder) CreateRenderer() fyne.WidgetRenderer {
+	return widget.NewSimpleRenderer(container.NewStack(r.box, container.NewCenter(r.label)))
+}
+
+func (r *keyRecorder) refresh() {
+	switch {
+	case r.recording && r.focused:
+		r.label.Text = "Recording • type and click here • ESC stops"
+		r.box.StrokeColor = r.editor.app.palette.Error
+	case r.recording:
+		r.label.Text = "Click here to keep recording"
+		r.box.StrokeColor = r.editor.app.palette.Warning
+	default:
+		r.label.Text = "Press Record to capture keys and clicks"
+		r.box.StrokeColor = r.editor.app.palette.Hint
+	}
+	r.label.Refresh()
+	r.box.Refresh()
+}
+
+// add records a token, folding a quick repeat into its double token
+func (r *keyRecorder) add(token string) {
+	if !r.recording || token == "" {
+		return
+	}
+	now := time.Now()
+	double := ""
+	for d, single := range doubleTokens {
+		if single == token {
+			double = d
+		}
+	}
+	if double != "" && token == r.last && now.Sub(r.lastAt) <= r.editor.app.settings.doubleInterval() &&
+		strings.HasSuffix(r.editor.keys.Text, token) {
+		r.editor.keys.SetText(strings.TrimSuffix(r.editor.keys.Text, token) + double)
+		r.last = ""
+		return
+	}
+	r.editor.appendToken(token)
+	r.last = token
+	r.lastAt = now
+}
+
+func (r *keyRecorder) FocusGained() {
+	r.focused = true
+	r.refresh()
+}
+
+func (r *keyRecorder) FocusLost() {
+	r.focused = false
+	r.refresh()
+}
+
+// AcceptsTab records Tab instead of moving focus
+func (r *keyRecorder) AcceptsTab() bool {
+	return true
+}
+
+func (r *keyRecorder) TypedKey(key *fyne.KeyEvent) {
+	if key.Name == fyne.KeyEscape {
+		r.editor.stopRecording()
+		return
+	}
+	r.numpadKey = numpadToken(key.Physical.ScanCode)
+	if name, ok := keyNames[key.Name]; ok {
+		r.add(r.editor.app.settings.activeProfile().translate(name))
+	}
+}
+
+func (r *keyRecorder) TypedRune(ch rune) {
+	// Space arrives as SPACE through TypedKey
+	if ch == ' ' {
+		return
+	}
+	key := string(ch)
+	if r.numpadKey != "" {
+		key = r.numpadKey
+		r.numpadKey = ""
+	}
+	r.add(r.editor.app.settings.activeProfile().translate(key))
+}
+
+var _ desktop.Mouseable = (*keyRecorder)(nil)
+
+func (r *keyRecorder) MouseDown(e *desktop.MouseEvent) {
+	wasFocused := r.focused
+	r.editor.window.Canvas().Focus(r)
+	// The click that brings focus back only resumes recording
+	if wasFocused {
+		r.add(clickToken(e))
+	}
+}
+
+func (r *keyRecorder) MouseUp(e *desktop.MouseEvent) {}
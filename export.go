@@ -0,0 +1,531 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// exportsDir is where the idle screen's export writes to
+const exportsDir = "exports"
+
+// reportWeeks is how many weeks the report trends cover
+const reportWeeks = 12
+
+// table is a flat view of part of the stats, for CSV and JSON Lines
+type table struct {
+	name    string
+	columns []string
+	rows    [][]any
+}
+
+// tables flattens the stats into patterns, mistakes and sessions. Times are
+// in milliseconds so spreadsheets can do arithmetic on them.
+func (s *AllStats) tables() []table {
+	patterns := table{name: "patterns", columns: []string{
+		"id", "name", "pattern", "template", "attempts", "perfect", "perfect_rate", "resets", "forgiven",
+		"best_ms", "avg_ms", "current_streak", "best_streak", "last_practiced",
+		"drags", "avg_drag_coverage", "rhythm_bpm", "rhythm_top_bpm",
+		"recall_attempts", "recall_perfect", "recall_best_ms", "recall_avg_ms",
+	}}
+	mistakes := table{name: "mistakes", columns: []string{
+		"pattern_id", "pattern_name", "position", "expected", "actual", "timestamp",
+	}}
+	sessions := table{name: "sessions", columns: []string{
+		"start", "end", "duration_ms", "profile", "patterns_total", "patterns_perfect", "perfect_rate", "completed",
+	}}
+	daily := table{name: "daily", columns: []string{
+		"profile", "date", "perfect", "total", "time_ms", "completed",
+	}}
+
+	for _, id := range s.patternIDs() {
+		ps := s.PatternStats[id]
+		var avg int64
+		if ps.TotalAttempts > 0 {
+			avg = (ps.TotalTime / time.Duration(ps.TotalAttempts)).Milliseconds()
+		}
+		var coverage float64
+		if ps.DragCount > 0 {
+			coverage = ps.DragCoverage / float64(ps.DragCount)
+		}
+		var bpm, topBPM int
+		if ps.Rhythm != nil {
+			bpm, topBPM = ps.Rhythm.BPM, ps.Rhythm.TopBPM
+		}
+		var recall RecallStats
+		var recallAvg int64
+		if ps.Recall != nil {
+			recall = *ps.Recall
+			if recall.Attempts > 0 {
+				recallAvg = (recall.TotalTime / time.Duration(recall.Attempts)).Milliseconds()
+			}
+		}
+		patterns.rows = append(patterns.rows, []any{
+			id, ps.Name, ps.Pattern, ps.Template, ps.TotalAttempts, ps.PerfectCount, rate(ps.PerfectCount, ps.TotalAttempts), ps.TotalResets, ps.TotalForgiven,
+			ps.BestTime.Milliseconds(), avg, ps.CurrentStreak, ps.BestStreak, ps.LastPracticed,
+			ps.DragCount, coverage, bpm, topBPM,
+			recall.Attempts, recall.PerfectCount, recall.BestTime.Milliseconds(), recallAvg,
+		})
+		for _, m := range ps.Mistakes {
+			mistakes.rows = append(mistakes.rows, []any{id, ps.Name, m.Position, m.Expected, m.Actual, m.Timestamp})
+		}
+	}
+	sort.SliceStable(mistakes.rows, func(i, j int) bool {
+		return mistakes.rows[i][5].(time.Time).Before(mistakes.rows[j][5].(time.Time))
+	})
+
+	for _, rec := range s.Sessions {
+		sessions.rows = append(sessions.rows, []any{
+			rec.StartTime, rec.EndTime, rec.Duration.Milliseconds(), sessionProfile(rec),
+			rec.PatternsTotal, rec.PatternsPerfect, rate(rec.PatternsPerfect, rec.PatternsTotal), rec.Completed,
+		})
+	}
+	for profile, ds := range s.Daily {
+		for _, score := range ds.History {
+			daily.rows = append(daily.rows, []any{
+				profile, score.Date, score.Perfect, score.Total, score.Time.Milliseconds(), score.Completed,
+			})
+		}
+	}
+	sort.SliceStable(daily.rows, func(i, j int) bool {
+		a, b := daily.rows[i], daily.rows[j]
+		if a[0] != b[0] {
+			return a[0].(string) < b[0].(string)
+		}
+		return a[1].(string) < b[1].(string)
+	})
+	return []table{patterns, mistakes, sessions, daily}
+}
+
+// patternIDs lists the stats' pattern IDs by pattern name
+func (s *AllStats) patternIDs() []string {
+	ids := make([]string, 0, len(s.PatternStats))
+	for id := range s.PatternStats {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		a, b := s.PatternStats[ids[i]], s.PatternStats[ids[j]]
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return ids[i] < ids[j]
+	})
+	return ids
+}
+
+func rate(n, of int) float64 {
+	if of == 0 {
+		return 0
+	}
+	return float64(n) / float64(of)
+}
+
+// sessionProfile is the profile a session was played on; sessions from
+// before profiles were recorded count as the default one
+func sessionProfile(rec SessionRecord) string {
+	if rec.Profile == "" {
+		return defaultProfile
+	}
+	return rec.Profile
+}
+
+func (t table) writeCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write(t.columns)
+	for _, row := range t.rows {
+		fields := make([]string, len(row))
+		for i, v := range row {
+			fields[i] = csvValue(v)
+		}
+		cw.Write(fields)
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func csvValue(v any) string {
+	switch v := v.(type) {
+	case time.Time:
+		if v.IsZero() {
+			return ""
+		}
+		return v.Format(time.RFC3339)
+	case float64:
+		return strconv.FormatFloat(v, 'f', 3, 64)
+	}
+	return fmt.Sprint(v)
+}
+
+// writeJSONL writes one object per row, keeping the column order
+func (t table) writeJSONL(w io.Writer) error {
+	for _, row := range t.rows {
+		var b strings.Builder
+		b.WriteByte('{')
+		for i, v := range row {
+			if ts, ok := v.(time.Time); ok && ts.IsZero() {
+				v = nil
+			}
+			key, _ := json.Marshal(t.columns[i])
+			value, err := json.Marshal(v)
+			if err != nil {
+				return err
+			}
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			b.Write(key)
+			b.WriteByte(':')
+			b.Write(value)
+		}
+		b.WriteString("}\n")
+		if _, err := io.WriteString(w, b.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// exportStats writes each table as CSV and JSON Lines, and a Markdown and
+// HTML report for every profile that has played, into dir. The HTML report
+// is drawn in palette. It returns the files written.
+func exportStats(stats *AllStats, dir, profile string, palette *Palette) ([]string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	var written []string
+	write := func(name string, fn func(io.Writer) error) error {
+		path := filepath.Join(dir, name)
+		file, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		bw := bufio.NewWriter(file)
+		err = fn(bw)
+		if ferr := bw.Flush(); err == nil {
+			err = ferr
+		}
+		if cerr := file.Close(); err == nil {
+			err = cerr
+		}
+		written = append(written, path)
+		return err
+	}
+
+	for _, t := range stats.tables() {
+		if err := write(t.name+".csv", t.writeCSV); err != nil {
+			return written, err
+		}
+		if err := write(t.name+".jsonl", t.writeJSONL); err != nil {
+			return written, err
+		}
+	}
+
+	now := time.Now()
+	for _, name := range stats.profiles(profile) {
+		r := stats.report(name, now)
+		r.palette = palette
+		slug := reportSlug(name)
+		if err := write("report-"+slug+".md", r.writeMarkdown); err != nil {
+			return written, err
+		}
+		if err := write("report-"+slug+".html", r.writeHTML); err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// profiles lists the profiles with sessions, plus the current one
+func (s *AllStats) profiles(current string) []string {
+	seen := map[string]bool{current: true}
+	for _, rec := range s.Sessions {
+		seen[sessionProfile(rec)] = true
+	}
+	var names []string
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// reportSlug makes a profile name safe to use in a file name
+func reportSlug(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == '_' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// report is one profile's progress report
+type report struct {
+	profile   string
+	generated time.Time
+	palette   *Palette // colors of the HTML report
+
+	sessions  int
+	completed int
+	trained   time.Duration
+	total     int // patterns played
+	perfect   int
+	practiced int // patterns with at least one attempt
+
+	weeks    []reportWeek
+	patterns []*PatternStats // most practiced first
+	misses   []reportMiss
+}
+
+// reportWeek is one week of a profile's sessions
+type reportWeek struct {
+	start    time.Time
+	sessions int
+	trained  time.Duration
+	total    int
+	perfect  int
+}
+
+// reportMiss is a mistake made more than once
+type reportMiss struct {
+	expected, actual string
+	count            int
+}
+
+func (s *AllStats) report(profile string, now time.Time) *report {
+	r := &report{profile: profile, generated: now}
+
+	// Weeks start on Monday, oldest first
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	monday := day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+	for i := reportWeeks - 1; i >= 0; i-- {
+		r.weeks = append(r.weeks, reportWeek{start: monday.AddDate(0, 0, -7*i)})
+	}
+
+	for _, rec := range s.Sessions {
+		if sessionProfile(rec) != profile {
+			continue
+		}
+		r.sessions++
+		if rec.Completed {
+			r.completed++
+		}
+		r.trained += rec.Duration
+		r.total += rec.PatternsTotal
+		r.perfect += rec.PatternsPerfect
+		for i := len(r.weeks) - 1; i >= 0; i-- {
+			if w := &r.weeks[i]; !rec.StartTime.Before(w.start) {
+				w.sessions++
+				w.trained += rec.Duration
+				w.total += rec.PatternsTotal
+				w.perfect += rec.PatternsPerfect
+				break
+			}
+		}
+	}
+
+	misses := make(map[[2]string]int)
+	for _, id := range s.patternIDs() {
+		ps := s.PatternStats[id]
+		if ps.TotalAttempts > 0 {
+			r.practiced++
+			r.patterns = append(r.patterns, ps)
+		}
+		for _, m := range ps.Mistakes {
+			misses[[2]string{m.Expected, m.Actual}]++
+		}
+	}
+	sort.SliceStable(r.patterns, func(i, j int) bool {
+		return r.patterns[i].TotalAttempts > r.patterns[j].TotalAttempts
+	})
+	r.patterns = r.patterns[:min(len(r.patterns), 20)]
+
+	for pair, count := range misses {
+		if count > 1 {
+			r.misses = append(r.misses, reportMiss{expected: pair[0], actual: pair[1], count: count})
+		}
+	}
+	sort.Slice(r.misses, func(i, j int) bool {
+		if r.misses[i].count != r.misses[j].count {
+			return r.misses[i].count > r.misses[j].count
+		}
+		return r.misses[i].expected+r.misses[i].actual < r.misses[j].expected+r.misses[j].actual
+	})
+	r.misses = r.misses[:min(len(r.misses), 10)]
+	return r
+}
+
+// formatMs shows a duration to the tenth of a second, or "-" if unset
+func formatMs(d time.Duration) string {
+	if d <= 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1fs", d.Seconds())
+}
+
+func averageTime(ps *PatternStats) time.Duration {
+	if ps.TotalAttempts == 0 {
+		return 0
+	}
+	return ps.TotalTime / time.Duration(ps.TotalAttempts)
+}
+
+// sparkline draws values as a row of block characters
+func sparkline(values []float64) string {
+	blocks := []rune("▁▂▃▄▅▆▇█")
+	top := 0.0
+	for _, v := range values {
+		top = max(top, v)
+	}
+	var b strings.Builder
+	for _, v := range values {
+		if top == 0 {
+			b.WriteRune(blocks[0])
+			continue
+		}
+		b.WriteRune(blocks[int(v/top*float64(len(blocks)-1)+0.5)])
+	}
+	return b.String()
+}
+
+func (r *report) trend() (minutes, rates []float64) {
+	for _, w := range r.weeks {
+		minutes = append(minutes, w.trained.Minutes())
+		rates = append(rates, rate(w.perfect, w.total))
+	}
+	return minutes, rates
+}
+
+func (r *report) writeMarkdown(w io.Writer) error {
+	fmt.Fprintf(w, "# Keystroke Trainer report: %s\n\n", r.profile)
+	fmt.Fprintf(w, "Generated %s. Pattern tables cover every profile; sessions and trends are %s's only.\n\n", r.generated.Format("2 Jan 2006 15:04"), r.profile)
+
+	fmt.Fprintf(w, "## Summary\n\n")
+	fmt.Fprintf(w, "| Sessions | Completed | Training time | Patterns played | Perfect | Patterns practiced |\n")
+	fmt.Fprintf(w, "|---|---|---|---|---|---|\n")
+	fmt.Fprintf(w, "| %d | %d | %s | %d | %.0f%% | %d |\n\n", r.sessions, r.completed, r.trained.Round(time.Minute), r.total, 100*rate(r.perfect, r.total), r.practiced)
+
+	minutes, rates := r.trend()
+	fmt.Fprintf(w, "## Last %d weeks\n\n", reportWeeks)
+	fmt.Fprintf(w, "Minutes trained `%s`  \nPerfect rate `%s`\n\n", sparkline(minutes), sparkline(rates))
+	fmt.Fprintf(w, "| Week of | Sessions | Minutes | Perfect |\n|---|---|---|---|\n")
+	for _, wk := range r.weeks {
+		fmt.Fprintf(w, "| %s | %d | %.0f | %.0f%% |\n", wk.start.Format("2 Jan"), wk.sessions, wk.trained.Minutes(), 100*rate(wk.perfect, wk.total))
+	}
+
+	fmt.Fprintf(w, "\n## Most practiced patterns\n\n")
+	fmt.Fprintf(w, "| Pattern | Keys | Attempts | Perfect | Best | Average | Last practiced |\n|---|---|---|---|---|---|---|\n")
+	for _, ps := range r.patterns {
+		fmt.Fprintf(w, "| %s | `%s` | %d | %.0f%% | %s | %s | %s |\n",
+			markdownCell(ps.Name), ps.Pattern, ps.TotalAttempts, 100*rate(ps.PerfectCount, ps.TotalAttempts),
+			formatMs(ps.BestTime), formatMs(averageTime(ps)), ps.LastPracticed.Format("2 Jan 2006"))
+	}
+
+	if len(r.misses) > 0 {
+		fmt.Fprintf(w, "\n## Most common mistakes\n\n| Expected | Pressed | Times |\n|---|---|---|\n")
+		for _, m := range r.misses {
+			fmt.Fprintf(w, "| `%s` | `%s` | %d |\n", m.expected, m.actual, m.count)
+		}
+	}
+	return nil
+}
+
+// markdownCell keeps a value from breaking a table row
+func markdownCell(s string) string {
+	return strings.ReplaceAll(s, "|", `\|`)
+}
+
+func (r *report) writeHTML(w io.Writer) error {
+	esc := html.EscapeString
+	p := r.palette
+	fmt.Fprintf(w, `<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>Keystroke Trainer report: %s</title>
+<style>
+body { font-family: sans-serif; background: %s; color: %s; max-width: 900px; margin: 2em auto; }
+h1, h2 { color: %s; }
+table { border-collapse: collapse; margin-bottom: 1.5em; }
+th, td { padding: 4px 12px; border-bottom: 1px solid %s; text-align: left; }
+code { color: %s; }
+</style></head><body>
+`, esc(r.profile), p.Background.css(), p.Input.css(), p.Info.css(), p.Panel.css(), p.Best.css())
+	fmt.Fprintf(w, "<h1>Keystroke Trainer report: %s</h1>\n", esc(r.profile))
+	fmt.Fprintf(w, "<p>Generated %s. Pattern tables cover every profile; sessions and trends are %s's only.</p>\n", r.generated.Format("2 Jan 2006 15:04"), esc(r.profile))
+
+	fmt.Fprintf(w, "<h2>Summary</h2>\n<table><tr><th>Sessions</th><th>Completed</th><th>Training time</th><th>Patterns played</th><th>Perfect</th><th>Patterns practiced</th></tr>\n")
+	fmt.Fprintf(w, "<tr><td>%d</td><td>%d</td><td>%s</td><td>%d</td><td>%.0f%%</td><td>%d</td></tr></table>\n", r.sessions, r.completed, r.trained.Round(time.Minute), r.total, 100*rate(r.perfect, r.total), r.practiced)
+
+	fmt.Fprintf(w, "<h2>Last %d weeks</h2>\n", reportWeeks)
+	r.writeTrendSVG(w)
+
+	fmt.Fprintf(w, "<h2>Most practiced patterns</h2>\n<table><tr><th>Pattern</th><th>Keys</th><th>Attempts</th><th>Perfect</th><th>Best</th><th>Average</th><th>Last practiced</th></tr>\n")
+	for _, ps := range r.patterns {
+		fmt.Fprintf(w, "<tr><td>%s</td><td><code>%s</code></td><td>%d</td><td>%.0f%%</td><td>%s</td><td>%s</td><td>%s</td></tr>\n",
+			esc(ps.Name), esc(formatForDisplay(ps.Pattern)), ps.TotalAttempts, 100*rate(ps.PerfectCount, ps.TotalAttempts),
+			formatMs(ps.BestTime), formatMs(averageTime(ps)), ps.LastPracticed.Format("2 Jan 2006"))
+	}
+	fmt.Fprintf(w, "</table>\n")
+
+	if len(r.misses) > 0 {
+		fmt.Fprintf(w, "<h2>Most common mistakes</h2>\n<table><tr><th>Expected</th><th>Pressed</th><th>Times</th></tr>\n")
+		for _, m := range r.misses {
+			fmt.Fprintf(w, "<tr><td><code>%s</code></td><td><code>%s</code></td><td>%d</td></tr>\n", esc(m.expected), esc(m.actual), m.count)
+		}
+		fmt.Fprintf(w, "</table>\n")
+	}
+	_, err := fmt.Fprintf(w, "</body></html>\n")
+	return err
+}
+
+// writeTrendSVG charts minutes trained per week as bars and the perfect
+// rate as a line
+func (r *report) writeTrendSVG(w io.Writer) {
+	const width, height, top, bottom = 720, 200, 20, 170
+	minutes, rates := r.trend()
+	most := 1.0
+	for _, m := range minutes {
+		most = max(most, m)
+	}
+	slot := float64(width) / float64(len(r.weeks))
+	p := r.palette
+
+	fmt.Fprintf(w, `<svg width="%d" height="%d" xmlns="http://www.w3.org/2000/svg">`+"\n", width, height)
+	var line []string
+	for i, wk := range r.weeks {
+		x := float64(i) * slot
+		h := minutes[i] / most * (bottom - top)
+		fmt.Fprintf(w, `<rect x="%.0f" y="%.0f" width="%.0f" height="%.0f" fill="%s"><title>%.0f min</title></rect>`+"\n",
+			x+slot*0.15, bottom-h, slot*0.7, h, p.Info.css(), minutes[i])
+		fmt.Fprintf(w, `<text x="%.0f" y="%d" fill="%s" font-size="11" text-anchor="middle">%s</text>`+"\n",
+			x+slot/2, height-12, p.Muted.css(), wk.start.Format("2 Jan"))
+		if wk.total > 0 {
+			line = append(line, fmt.Sprintf("%.0f,%.0f", x+slot/2, bottom-rates[i]*(bottom-top)))
+		}
+	}
+	if len(line) > 0 {
+		fmt.Fprintf(w, `<polyline points="%s" fill="none" stroke="%s" stroke-width="2"/>`+"\n", strings.Join(line, " "), p.Success.css())
+	}
+	fmt.Fprintf(w, "</svg>\n<p>Bars: minutes trained. Line: perfect rate.</p>\n")
+}
+
+// exportFromIdle writes the export for the idle screen's X key
+func (app *App) exportFromIdle() {
+	_, err := exportStats(app.stats, exportsDir, app.settings.profileName(), app.palette)
+	if err != nil {
+		app.statusLabel.Text = "❌ " + err.Error()
+		app.statusLabel.Color = app.palette.Error
+	} else {
+		app.statusLabel.Text = fmt.Sprintf("📊 Stats and report exported to %s/", exportsDir)
+		app.statusLabel.Color = app.palette.Success
+	}
+	app.statusLabel.Refresh()
+}
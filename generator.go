@@ -0,0 +1,433 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// templatesFile holds the grammars generated patterns are drawn from
+const templatesFile = "pattern_templates.txt"
+
+// Template is a named grammar for random patterns. Each pattern it makes
+// keeps its own stats, marked with the template's ID so they can be added
+// up per template.
+type Template struct {
+	ID      string `json:"id,omitempty"`
+	Name    string `json:"name"`
+	Grammar string `json:"grammar"`
+}
+
+var defaultTemplates = []Template{
+	{Name: "Random cycle", Grammar: "({1-9}! {a,s,h} LC)x3-4"},
+	{Name: "Hotkey and cast", Grammar: "{1-9} {t,e,c} LC"},
+	{Name: "Camera rally", Grammar: "{F2-F4} {1-9}! RC"},
+	{Name: "Double-tap orders", Grammar: "({DT1-DT5}! {a,m,h} LC)x2"},
+}
+
+func (t Template) key() string {
+	if t.ID != "" {
+		return t.ID
+	}
+	return "tpl-" + patternHash(t.Grammar)
+}
+
+// term is one piece of a grammar: a pick from some choices, or a group
+// repeated between min and max times
+type term struct {
+	src      string
+	choices  []string
+	distinct bool // no choice comes up twice in one pattern
+	group    []term
+	min, max int
+}
+
+// grammar is a parsed template. Terms are separated by spaces:
+//
+//	LC          a literal, any pattern keys
+//	{a,s,h}     one of the choices
+//	{1-9}       one of a range: digits, letters, or F1-F4, DT1-DT5, NUM1-NUM9
+//	{1-9}!      as above, never picking the same one twice in a pattern
+//	( ... )x3   the group three times; x2-4 for two to four times
+type grammar []term
+
+// loadTemplates loads templates from the working directory or next to the
+// executable, or returns the defaults
+func loadTemplates() []Template {
+	templates, err := loadTemplatesFromFile(templatesFile)
+	if err == nil && len(templates) > 0 {
+		return templates
+	}
+
+	exePath, err := os.Executable()
+	if err == nil {
+		templates, err = loadTemplatesFromFile(filepath.Join(filepath.Dir(exePath), templatesFile))
+		if err == nil && len(templates) > 0 {
+			return templates
+		}
+	}
+
+	return defaultTemplates
+}
+
+// loadTemplatesFromFile reads "Name|grammar|id" lines, where the ID is
+// optional
+func loadTemplatesFromFile(path string) ([]Template, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var templates []Template
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.SplitN(line, "|", 3)
+		if len(parts) < 2 {
+			continue
+		}
+		t := Template{Name: strings.TrimSpace(parts[0]), Grammar: strings.TrimSpace(parts[1])}
+		if len(parts) == 3 {
+			t.ID = strings.TrimSpace(parts[2])
+		}
+		templates = append(templates, t)
+	}
+	return templates, scanner.Err()
+}
+
+// parseGrammar parses and checks a template's grammar
+func parseGrammar(src string) (grammar, error) {
+	p := &grammarParser{src: src}
+	terms, err := p.sequence(false)
+	if err != nil {
+		return nil, err
+	}
+	if len(terms) == 0 {
+		return nil, fmt.Errorf("empty grammar")
+	}
+	if err := checkDistinct(terms, 1); err != nil {
+		return nil, err
+	}
+	return grammar(terms), nil
+}
+
+type grammarParser struct {
+	src string
+	pos int
+}
+
+func (p *grammarParser) sequence(inGroup bool) ([]term, error) {
+	var terms []term
+	for {
+		for p.pos < len(p.src) && (p.src[p.pos] == ' ' || p.src[p.pos] == '\t') {
+			p.pos++
+		}
+		if p.pos == len(p.src) {
+			if inGroup {
+				return nil, fmt.Errorf("unclosed (")
+			}
+			return terms, nil
+		}
+
+		start := p.pos
+		switch p.src[p.pos] {
+		case '(':
+			p.pos++
+			group, err := p.sequence(true)
+			if err != nil {
+				return nil, err
+			}
+			if len(group) == 0 {
+				return nil, fmt.Errorf("empty group at %d", start+1)
+			}
+			t := term{group: group, min: 1, max: 1}
+			if err := p.repeat(&t); err != nil {
+				return nil, err
+			}
+			t.src = p.src[start:p.pos]
+			terms = append(terms, t)
+		case ')':
+			if !inGroup {
+				return nil, fmt.Errorf("unexpected ) at %d", start+1)
+			}
+			p.pos++
+			return terms, nil
+		case '{':
+			end := strings.IndexByte(p.src[p.pos:], '}')
+			if end < 0 {
+				return nil, fmt.Errorf("unclosed { at %d", start+1)
+			}
+			choices, err := parseChoices(p.src[p.pos+1 : p.pos+end])
+			if err != nil {
+				return nil, err
+			}
+			p.pos += end + 1
+			t := term{choices: choices}
+			if p.pos < len(p.src) && p.src[p.pos] == '!' {
+				t.distinct = true
+				p.pos++
+			}
+			t.src = p.src[start:p.pos]
+			terms = append(terms, t)
+		default:
+			for p.pos < len(p.src) && !strings.ContainsRune(" \t(){}", rune(p.src[p.pos])) {
+				p.pos++
+			}
+			if p.pos == start {
+				return nil, fmt.Errorf("unexpected %c at %d", p.src[start], start+1)
+			}
+			literal := p.src[start:p.pos]
+			if err := checkKeys(literal); err != nil {
+				return nil, err
+			}
+			terms = append(terms, term{src: literal, choices: []string{literal}})
+		}
+	}
+}
+
+// repeat reads the x3 or x2-4 after a group, if there is one
+func (p *grammarParser) repeat(t *term) error {
+	if p.pos+1 >= len(p.src) || p.src[p.pos] != 'x' || !isDigit(p.src[p.pos+1]) {
+		return nil
+	}
+	p.pos++
+	var err error
+	if t.min, err = p.number(); err != nil {
+		return err
+	}
+	t.max = t.min
+	if p.pos < len(p.src) && p.src[p.pos] == '-' {
+		p.pos++
+		if t.max, err = p.number(); err != nil {
+			return err
+		}
+	}
+	if t.min < 1 || t.max < t.min {
+		return fmt.Errorf("bad repeat x%d-%d", t.min, t.max)
+	}
+	return nil
+}
+
+func (p *grammarParser) number() (int, error) {
+	start := p.pos
+	for p.pos < len(p.src) && isDigit(p.src[p.pos]) {
+		p.pos++
+	}
+	return strconv.Atoi(p.src[start:p.pos])
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// parseChoices reads the inside of {...}: keys and ranges separated by
+// commas
+func parseChoices(body string) ([]string, error) {
+	var choices []string
+	for _, item := range strings.Split(body, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			return nil, fmt.Errorf("empty choice in {%s}", body)
+		}
+		// A - inside an item is a range; at either end it's the - key
+		if i := strings.LastIndex(item, "-"); i > 0 && i < len(item)-1 {
+			expanded, err := expandRange(item[:i], item[i+1:])
+			if err != nil {
+				return nil, err
+			}
+			choices = append(choices, expanded...)
+			continue
+		}
+		if err := checkKeys(item); err != nil {
+			return nil, err
+		}
+		choices = append(choices, item)
+	}
+	return choices, nil
+}
+
+// expandRange lists a range like 1-9, a-f, F1-F4 or DT1-DT5
+func expandRange(lo, hi string) ([]string, error) {
+	var keys []string
+	if len(lo) == 1 && len(hi) == 1 && lo <= hi &&
+		(isDigit(lo[0]) && isDigit(hi[0]) || lo[0] >= 'a' && hi[0] <= 'z') {
+		for c := lo[0]; c <= hi[0]; c++ {
+			keys = append(keys, string(c))
+		}
+	} else {
+		prefix := strings.TrimRight(lo, "0123456789")
+		from, errLo := strconv.Atoi(lo[len(prefix):])
+		to, errHi := strconv.Atoi(strings.TrimPrefix(hi, prefix))
+		if prefix == "" || !strings.HasPrefix(hi, prefix) || errLo != nil || errHi != nil || from > to {
+			return nil, fmt.Errorf("bad range %s-%s", lo, hi)
+		}
+		for n := from; n <= to; n++ {
+			keys = append(keys, prefix+strconv.Itoa(n))
+		}
+	}
+	for _, key := range keys {
+		if err := checkKeys(key); err != nil {
+			return nil, err
+		}
+	}
+	return keys, nil
+}
+
+// checkKeys makes sure a literal or choice is made of pattern tokens
+func checkKeys(keys string) error {
+	if problems := patternProblems(Pattern{Name: keys, Pattern: keys}); len(problems) > 0 {
+		return fmt.Errorf("%s: %s", keys, strings.Join(problems, ", "))
+	}
+	return nil
+}
+
+// checkDistinct makes sure a term marked ! has enough choices for every
+// time it can come up
+func checkDistinct(terms []term, times int) error {
+	for _, t := range terms {
+		if t.group != nil {
+			if err := checkDistinct(t.group, times*t.max); err != nil {
+				return err
+			}
+			continue
+		}
+		if t.distinct && times > len(t.choices) {
+			return fmt.Errorf("%s can come up %d times but has %d choices", t.src, times, len(t.choices))
+		}
+	}
+	return nil
+}
+
+// generate draws a pattern from the grammar
+func (g grammar) generate(rng *rand.Rand) string {
+	var b strings.Builder
+	writeTerms(&b, g, rng, make(map[*term]map[string]bool))
+	return b.String()
+}
+
+func writeTerms(b *strings.Builder, terms []term, rng *rand.Rand, used map[*term]map[string]bool) {
+	for i := range terms {
+		t := &terms[i]
+		if t.group != nil {
+			for range t.min + rng.Intn(t.max-t.min+1) {
+				writeTerms(b, t.group, rng, used)
+			}
+			continue
+		}
+
+		choices := t.choices
+		if t.distinct {
+			choices = nil
+			for _, c := range t.choices {
+				if !used[t][c] {
+					choices = append(choices, c)
+				}
+			}
+		}
+		pick := choices[rng.Intn(len(choices))]
+		if t.distinct {
+			if used[t] == nil {
+				used[t] = make(map[string]bool)
+			}
+			used[t][pick] = true
+		}
+		b.WriteString(pick)
+	}
+}
+
+// generatePatterns draws n patterns, each from a template picked at
+// random. Templates whose grammar doesn't parse are left out.
+func generatePatterns(templates []Template, n int, rng *rand.Rand) []Pattern {
+	type compiled struct {
+		template Template
+		grammar  grammar
+	}
+	var usable []compiled
+	for _, t := range templates {
+		if g, err := parseGrammar(t.Grammar); err == nil {
+			usable = append(usable, compiled{t, g})
+		}
+	}
+	if len(usable) == 0 {
+		return nil
+	}
+
+	patterns := make([]Pattern, n)
+	for i := range patterns {
+		c := usable[rng.Intn(len(usable))]
+		keys := c.grammar.generate(rng)
+		patterns[i] = Pattern{
+			ID:       patternHash(keys),
+			Name:     c.template.Name,
+			Pattern:  keys,
+			Template: c.template.key(),
+		}
+	}
+	return patterns
+}
+
+// templateNote sums up the record of every pattern drawn from the current
+// pattern's template, or "" for a pattern from the file
+func (app *App) templateNote() string {
+	template := app.currentPattern.Template
+	if template == "" {
+		return ""
+	}
+	attempts, perfect := 0, 0
+	var total time.Duration
+	for _, ps := range app.stats.PatternStats {
+		if ps.Template == template {
+			attempts += ps.TotalAttempts
+			perfect += ps.PerfectCount
+			total += ps.TotalTime
+		}
+	}
+	if attempts == 0 {
+		return ""
+	}
+	avg := total / time.Duration(attempts)
+	return fmt.Sprintf(" • 🎲 Template: %d/%d perfect, avg %.1fs", perfect, attempts, avg.Seconds())
+}
+
+// generatedPatterns draws the session's generated patterns, from the
+// session's rng unless a generator seed fixes them
+func (app *App) generatedPatterns() []Pattern {
+	rng := app.rng
+	if app.settings.GeneratorSeed != 0 {
+		rng = rand.New(rand.NewSource(app.settings.GeneratorSeed))
+	}
+	return generatePatterns(app.templates, max(app.settings.GeneratedCount, 1), rng)
+}
+
+// printGenerated writes n samples of every template, or why its grammar
+// doesn't parse
+func printGenerated(w io.Writer, templates []Template, n int, seed int64) error {
+	rng := rand.New(rand.NewSource(seed))
+	failed := false
+	for _, t := range templates {
+		g, err := parseGrammar(t.Grammar)
+		if err != nil {
+			fmt.Fprintf(w, "# %s: %v\n", t.Name, err)
+			failed = true
+			continue
+		}
+		fmt.Fprintf(w, "# %s (%s)\n", t.Name, t.Grammar)
+		for range n {
+			fmt.Fprintln(w, g.generate(rng))
+		}
+	}
+	if failed {
+		return fmt.Errorf("some templates don't parse")
+	}
+	return nil
+}
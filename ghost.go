@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+)
+
+// ghostFrame is how often the ghost cursor moves
+const ghostFrame = 33 * time.Millisecond
+
+// splitTokens breaks a pattern into its tokens
+func splitTokens(pattern string) []string {
+	var tokens []string
+	for pos := 0; pos < len(pattern); {
+		token := getExpectedKey(pattern, pos)
+		tokens = append(tokens, token)
+		pos += len(token)
+	}
+	return tokens
+}
+
+// pbSplits returns the personal best splits for the current pattern, or nil
+// if there is no usable record
+func (app *App) pbSplits() []time.Duration {
+	ps, ok := app.stats.PatternStats[app.currentPattern.key()]
+	if !ok || len(ps.BestSplits) != len(splitTokens(app.currentPattern.Pattern)) {
+		return nil
+	}
+	return ps.BestSplits
+}
+
+// startGhost begins racing the personal best once the first token lands
+func (app *App) startGhost() {
+	app.stopGhost()
+	if app.pbSplits() == nil {
+		return
+	}
+
+	stop := make(chan struct{})
+	app.ghostStop = stop
+	go func() {
+		ticker := time.NewTicker(ghostFrame)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				fyne.Do(app.updateGhost)
+			}
+		}
+	}()
+}
+
+func (app *App) stopGhost() {
+	if app.ghostStop != nil {
+		close(app.ghostStop)
+		app.ghostStop = nil
+	}
+	app.ghostCursor.Hide()
+}
+
+// updateGhost moves the cursor to where the personal best run was at this
+// point, interpolating between its token times
+func (app *App) updateGhost() {
+	splits := app.pbSplits()
+	if splits == nil || app.startTime.IsZero() {
+		return
+	}
+	tokens := splitTokens(app.currentPattern.Pattern)
+	elapsed := app.now().Sub(app.startTime)
+
+	done := 0
+	for done < len(splits) && splits[done] <= elapsed {
+		done++
+	}
+	x := app.targetWidth(tokens[:done])
+	if done > 0 && done < len(splits) {
+		// Slide across the next token in proportion to the PB's time on it
+		span := splits[done] - splits[done-1]
+		if span > 0 {
+			frac := float32(elapsed-splits[done-1]) / float32(span)
+			x += frac * (app.targetWidth(tokens[:done+1]) - x)
+		}
+	}
+
+	origin := app.targetDisplay.Position()
+	app.ghostCursor.Move(fyne.NewPos(origin.X+x, origin.Y))
+	app.ghostCursor.Resize(fyne.NewSize(3, app.targetDisplay.Size().Height))
+	app.ghostCursor.Show()
+	app.ghostCursor.Refresh()
+}
+
+// targetWidth measures how wide the given tokens render in the target display
+func (app *App) targetWidth(tokens []string) float32 {
+	text := formatForDisplay(strings.Join(tokens, ""))
+	return fyne.MeasureText(text, app.targetDisplay.TextSize, app.targetDisplay.TextStyle).Width
+}
+
+// showSplitComparison summarises a finished perfect run against the
+// previous personal best
+func (app *App) showSplitComparison(prev, splits []time.Duration) {
+	if len(prev) == 0 || len(prev) != len(splits) {
+		return
+	}
+	tokens := splitTokens(app.currentPattern.Pattern)
+
+	gainAt, lossAt := -1, -1
+	var gain, loss time.Duration
+	for i := range splits {
+		var segment, pbSegment time.Duration
+		if i > 0 {
+			segment = splits[i] - splits[i-1]
+			pbSegment = prev[i] - prev[i-1]
+		}
+		if delta := segment - pbSegment; delta < gain {
+			gain, gainAt = delta, i
+		} else if delta > loss {
+			loss, lossAt = delta, i
+		}
+	}
+
+	total := splits[len(splits)-1] - prev[len(prev)-1]
+	text := fmt.Sprintf("vs PB %+.2fs", total.Seconds())
+	if gainAt >= 0 {
+		text += fmt.Sprintf(" • gained %.2fs at %s", -gain.Seconds(), formatForDisplay(tokens[gainAt]))
+	}
+	if lossAt >= 0 {
+		text += fmt.Sprintf(" • lost %.2fs at %s", loss.Seconds(), formatForDisplay(tokens[lossAt]))
+	}
+	app.progressLabel.Text = text
+	if total < 0 {
+		app.progressLabel.Color = app.palette.Success
+	} else {
+		app.progressLabel.Color = app.palette.Warning
+	}
+	app.progressLabel.Refresh()
+}
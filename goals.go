@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+)
+
+// masteryStreak is how many perfect runs in a row master a pattern
+const masteryStreak = 5
+
+// practiceDays lists the days with a session on a profile, or on any
+// profile for ""
+func (s *AllStats) practiceDays(profile string) map[string]bool {
+	days := make(map[string]bool)
+	for _, rec := range s.Sessions {
+		if profile == "" || sessionProfile(rec) == profile {
+			days[rec.StartTime.Format("2006-01-02")] = true
+		}
+	}
+	return days
+}
+
+// practiceStreaks returns the run of practice days still alive on today,
+// which it is until a day passes without a session, and the longest run
+func (s *AllStats) practiceStreaks(profile string, today time.Time) (current, best int) {
+	days := s.practiceDays(profile)
+	for day := range days {
+		// Count forward from the first day of each run
+		if days[previousDay(day)] {
+			continue
+		}
+		run := 1
+		last := day
+		for next := nextDay(day); days[next]; next = nextDay(next) {
+			run++
+			last = next
+		}
+		best = max(best, run)
+		if date := today.Format("2006-01-02"); last == date || last == previousDay(date) {
+			current = run
+		}
+	}
+	return current, best
+}
+
+func nextDay(date string) string {
+	day, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return ""
+	}
+	return day.AddDate(0, 0, 1).Format("2006-01-02")
+}
+
+// weekStart is midnight on the Monday of the week a moment falls in
+func weekStart(t time.Time) time.Time {
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+}
+
+// trainedSince is the time trained on a profile since a moment
+func (s *AllStats) trainedSince(profile string, since time.Time) time.Duration {
+	var total time.Duration
+	for _, rec := range s.Sessions {
+		if sessionProfile(rec) == profile && !rec.StartTime.Before(since) {
+			total += rec.Duration
+		}
+	}
+	return total
+}
+
+// masteredSince counts patterns a profile mastered since a moment
+func (s *AllStats) masteredSince(profile string, since time.Time) int {
+	n := 0
+	for _, ps := range s.PatternStats {
+		if m := ps.Mastery[profile]; m != nil && !m.MasteredAt.IsZero() && !m.MasteredAt.Before(since) {
+			n++
+		}
+	}
+	return n
+}
+
+// dailyMinutes is the day's share of the weekly minutes goal
+func (p *Profile) dailyMinutes() int {
+	return (p.GoalMinutes + 6) / 7
+}
+
+// goalProgress sums up the practice streak and the week's goals for the
+// idle screen
+func (app *App) goalProgress() string {
+	// A replay's stats are made up for the viewer
+	if app.playback {
+		return ""
+	}
+	now := time.Now()
+	profile := app.settings.profileName()
+	goals := app.settings.activeProfile()
+
+	var parts []string
+	if streak, _ := app.stats.practiceStreaks(profile, now); streak > 0 {
+		parts = append(parts, fmt.Sprintf("🔥 %d-day streak", streak))
+	}
+	week := weekStart(now)
+	if goals.GoalMinutes > 0 {
+		minutes := int(app.stats.trainedSince(profile, week) / time.Minute)
+		parts = append(parts, fmt.Sprintf("%s%d/%d min this week", goalMark(minutes, goals.GoalMinutes), minutes, goals.GoalMinutes))
+	}
+	if goals.GoalMastered > 0 {
+		mastered := app.stats.masteredSince(profile, week)
+		parts = append(parts, fmt.Sprintf("%s%d/%d mastered", goalMark(mastered, goals.GoalMastered), mastered, goals.GoalMastered))
+	}
+	return strings.Join(parts, " • ")
+}
+
+func goalMark(have, need int) string {
+	if have >= need {
+		return "✅ "
+	}
+	return ""
+}
+
+// startReminders checks once a minute whether to remind the player to
+// practise
+func (app *App) startReminders() {
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+		for range ticker.C {
+			fyne.Do(app.remind)
+		}
+	}()
+}
+
+// remind sends the day's reminder once the reminder time has passed, if
+// the day's share of the minutes goal isn't trained yet, or without a
+// minutes goal if there's been no practice at all
+func (app *App) remind() {
+	at, err := time.Parse("15:04", app.settings.Reminder)
+	if err != nil || app.inSession {
+		return
+	}
+	now := time.Now()
+	today := now.Format("2006-01-02")
+	if app.reminded == today || now.Hour()*60+now.Minute() < at.Hour()*60+at.Minute() {
+		return
+	}
+
+	profile := app.settings.profileName()
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	trained := int(app.stats.trainedSince(profile, midnight) / time.Minute)
+	need := app.settings.activeProfile().dailyMinutes()
+
+	var content string
+	switch {
+	case need > 0 && trained < need:
+		content = fmt.Sprintf("%d of today's %d minutes trained", trained, need)
+	case need == 0 && !app.stats.practiceDays(profile)[today]:
+		content = "No practice yet today"
+		if streak, _ := app.stats.practiceStreaks(profile, now); streak > 0 {
+			content = fmt.Sprintf("Keep your %d-day streak going", streak)
+		}
+	default:
+		return
+	}
+	app.reminded = today
+	fyne.CurrentApp().SendNotification(fyne.NewNotification("⌨️ Time to practise", content))
+}
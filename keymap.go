@@ -0,0 +1,84 @@
+package main
+
+import (
+	"runtime"
+	"strings"
+)
+
+// layoutTables translate the character a keyboard layout produces to the
+// QWERTY character on the same physical key. Brood War binds hotkeys to
+// letters, not positions, so translate only applies the number row and
+// punctuation entries unless the profile opts into positional letters.
+var layoutTables = map[string]map[rune]rune{
+	"qwerty": {},
+	"azerty": {
+		'&': '1', 'é': '2', '"': '3', '\'': '4', '(': '5',
+		'-': '6', 'è': '7', '_': '8', 'ç': '9', 'à': '0',
+		')': '-',
+		'a': 'q', 'z': 'w', '^': '[', '$': ']',
+		'q': 'a', 'm': ';', 'ù': '\'',
+		'w': 'z', ',': 'm', ';': ',', ':': '.', '!': '/',
+	},
+	"qwertz": {
+		'ß': '-', '´': '=',
+		'z': 'y', 'ü': '[', '+': ']',
+		'ö': ';', 'ä': '\'', '#': '\\',
+		'y': 'z', '-': '/',
+	},
+	"dvorak": {
+		'[': '-', ']': '=',
+		'\'': 'q', ',': 'w', '.': 'e', 'p': 'r', 'y': 't', 'f': 'y',
+		'g': 'u', 'c': 'i', 'r': 'o', 'l': 'p', '/': '[', '=': ']',
+		'o': 's', 'e': 'd', 'u': 'f', 'i': 'g', 'd': 'h',
+		'h': 'j', 't': 'k', 'n': 'l', 's': ';', '-': '\'',
+		';': 'z', 'q': 'x', 'j': 'c', 'k': 'v', 'x': 'b', 'b': 'n',
+		'w': ',', 'v': '.', 'z': '/',
+	},
+}
+
+// translate turns a raw input token into the pattern token it stands for
+// under this profile: layout first, then any custom remap
+func (p *Profile) translate(key string) string {
+	if table, ok := layoutTables[strings.ToLower(p.Layout)]; ok {
+		if r := []rune(key); len(r) == 1 {
+			logical, ok := table[r[0]]
+			if ok && (p.PositionalLetters || !isLetter(r[0]) && !isLetter(logical)) {
+				key = string(logical)
+			}
+		}
+	}
+	if mapped, ok := p.Remap[key]; ok {
+		return mapped
+	}
+	return key
+}
+
+// isLetter reports whether r is one of the a-z letters hotkeys are bound to
+func isLetter(r rune) bool {
+	return r >= 'a' && r <= 'z'
+}
+
+// numpadScanCodes maps each platform's keypad scan codes to numpad tokens
+var numpadScanCodes = map[string]map[int]string{
+	"windows": {
+		0x52: "NUM0", 0x4F: "NUM1", 0x50: "NUM2", 0x51: "NUM3", 0x4B: "NUM4",
+		0x4C: "NUM5", 0x4D: "NUM6", 0x47: "NUM7", 0x48: "NUM8", 0x49: "NUM9",
+		0x53: "NUM.", 0x135: "NUM/", 0x37: "NUM*", 0x4A: "NUM-", 0x4E: "NUM+",
+	},
+	"linux": {
+		90: "NUM0", 87: "NUM1", 88: "NUM2", 89: "NUM3", 83: "NUM4",
+		84: "NUM5", 85: "NUM6", 79: "NUM7", 80: "NUM8", 81: "NUM9",
+		91: "NUM.", 106: "NUM/", 63: "NUM*", 82: "NUM-", 86: "NUM+",
+	},
+	"darwin": {
+		0x52: "NUM0", 0x53: "NUM1", 0x54: "NUM2", 0x55: "NUM3", 0x56: "NUM4",
+		0x57: "NUM5", 0x58: "NUM6", 0x59: "NUM7", 0x5B: "NUM8", 0x5C: "NUM9",
+		0x41: "NUM.", 0x4B: "NUM/", 0x43: "NUM*", 0x4E: "NUM-", 0x45: "NUM+",
+	},
+}
+
+// numpadToken returns the numpad token for a scan code, or "" for any
+// other key
+func numpadToken(scanCode int) string {
+	return numpadScanCodes[runtime.GOOS][scanCode]
+}
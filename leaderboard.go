@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// leaderboardQueueFile holds best times not yet accepted by the server
+const leaderboardQueueFile = "leaderboard_queue.json"
+
+// leaderboardRetry is how often queued scores and rankings are retried
+const leaderboardRetry = time.Minute
+
+// scoreSubmission is a best time sent to the team leaderboard server
+type scoreSubmission struct {
+	Hash    string    `json:"hash"`
+	Name    string    `json:"name"`
+	Player  string    `json:"player"`
+	Profile string    `json:"profile"`
+	BestMs  int64     `json:"best_ms"`
+	At      time.Time `json:"at"`
+}
+
+// who is the teammate a score belongs to. Trainers from before player
+// names filed scores under their profile.
+func (s scoreSubmission) who() string {
+	if s.Player != "" {
+		return s.Player
+	}
+	return s.Profile
+}
+
+// leaderboard syncs best times with a team server in the background. New
+// bests are queued on disk first, so nothing is lost while offline.
+type leaderboard struct {
+	url    string
+	player string // who our scores are filed under
+	client *http.Client
+	wake   chan struct{}
+
+	mu       sync.Mutex
+	hashes   []string // patterns to download rankings for
+	queue    []scoreSubmission
+	rankings map[string][]scoreSubmission
+}
+
+func newLeaderboard(serverURL, player string, patterns []Pattern) *leaderboard {
+	lb := &leaderboard{
+		url:      strings.TrimRight(serverURL, "/"),
+		player:   player,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		wake:     make(chan struct{}, 1),
+		rankings: make(map[string][]scoreSubmission),
+	}
+	lb.track(patterns)
+	if data, err := os.ReadFile(leaderboardQueueFile); err == nil {
+		json.Unmarshal(data, &lb.queue)
+	}
+	go lb.run()
+	return lb
+}
+
+// submit queues a new best time for upload
+func (lb *leaderboard) submit(pattern Pattern, profile string, best time.Duration) {
+	// A generated pattern is a one-off, not keys teammates share
+	if lb == nil || pattern.Template != "" || best <= 0 {
+		return
+	}
+	lb.mu.Lock()
+	lb.queue = append(lb.queue, scoreSubmission{
+		Hash:    patternHash(pattern.Pattern),
+		Name:    pattern.Name,
+		Player:  lb.player,
+		Profile: profile,
+		BestMs:  best.Milliseconds(),
+		At:      time.Now(),
+	})
+	lb.saveQueueLocked()
+	lb.mu.Unlock()
+	lb.poke()
+}
+
+// track downloads rankings for these patterns from now on, replacing the
+// ones tracked before
+func (lb *leaderboard) track(patterns []Pattern) {
+	if lb == nil {
+		return
+	}
+	hashes := make([]string, len(patterns))
+	for i, p := range patterns {
+		hashes[i] = patternHash(p.Pattern)
+	}
+	lb.mu.Lock()
+	lb.hashes = hashes
+	lb.mu.Unlock()
+	lb.poke()
+}
+
+// poke wakes the sync loop without waiting for it
+func (lb *leaderboard) poke() {
+	select {
+	case lb.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (lb *leaderboard) saveQueueLocked() {
+	if len(lb.queue) == 0 {
+		os.Remove(leaderboardQueueFile)
+		return
+	}
+	data, err := json.MarshalIndent(lb.queue, "", "  ")
+	if err != nil {
+		return
+	}
+	os.WriteFile(leaderboardQueueFile, data, 0644)
+}
+
+// run uploads the queue and refreshes rankings whenever a best is queued,
+// and retries every minute
+func (lb *leaderboard) run() {
+	ticker := time.NewTicker(leaderboardRetry)
+	defer ticker.Stop()
+	for {
+		if lb.flush() == nil {
+			lb.fetch()
+		}
+		select {
+		case <-lb.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// flush uploads everything queued, keeping it if the server can't be
+// reached. Scores the server refuses outright are dropped, since sending
+// them again would only be refused again.
+func (lb *leaderboard) flush() error {
+	lb.mu.Lock()
+	pending := append([]scoreSubmission(nil), lb.queue...)
+	lb.mu.Unlock()
+	if len(pending) == 0 {
+		return nil
+	}
+
+	body, err := json.Marshal(pending)
+	if err != nil {
+		return err
+	}
+	resp, err := lb.client.Post(lb.url+"/scores", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode / 100 {
+	case 2:
+		var result struct {
+			Rejected []struct {
+				Index int    `json:"index"`
+				Error string `json:"error"`
+			} `json:"rejected"`
+		}
+		json.NewDecoder(resp.Body).Decode(&result)
+		for _, r := range result.Rejected {
+			if r.Index >= 0 && r.Index < len(pending) {
+				fmt.Fprintf(os.Stderr, "leaderboard: %s not kept: %s\n", pending[r.Index].Name, r.Error)
+			}
+		}
+	case 4:
+		fmt.Fprintf(os.Stderr, "leaderboard: dropped %d scores: %s\n", len(pending), resp.Status)
+	default:
+		return fmt.Errorf("leaderboard: %s", resp.Status)
+	}
+
+	// Scores queued during the upload stay for the next round
+	lb.mu.Lock()
+	lb.queue = lb.queue[len(pending):]
+	lb.saveQueueLocked()
+	lb.mu.Unlock()
+	return nil
+}
+
+// fetch downloads the team rankings for our patterns
+func (lb *leaderboard) fetch() error {
+	lb.mu.Lock()
+	query := url.Values{"hash": lb.hashes}
+	lb.mu.Unlock()
+	resp, err := lb.client.Get(lb.url + "/rankings?" + query.Encode())
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("leaderboard: %s", resp.Status)
+	}
+
+	rankings := make(map[string][]scoreSubmission)
+	if err := json.NewDecoder(resp.Body).Decode(&rankings); err != nil {
+		return err
+	}
+	lb.mu.Lock()
+	lb.rankings = rankings
+	lb.mu.Unlock()
+	return nil
+}
+
+// standing describes where we stand on a pattern's team ranking, or "" if
+// nobody has a time yet
+func (lb *leaderboard) standing(pattern string) string {
+	if lb == nil {
+		return ""
+	}
+	lb.mu.Lock()
+	ranking := lb.rankings[patternHash(pattern)]
+	lb.mu.Unlock()
+
+	if len(ranking) == 0 {
+		return ""
+	}
+	for i, s := range ranking {
+		if s.who() == lb.player {
+			return fmt.Sprintf("Team #%d of %d", i+1, len(ranking))
+		}
+	}
+	top := ranking[0]
+	return fmt.Sprintf("Team best %v (%s)", time.Duration(top.BestMs)*time.Millisecond, top.who())
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"bufio"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"image/color"
 	"math/rand"
@@ -18,21 +19,27 @@ import (
 	"fyne.io/fyne/v2/driver/desktop"
 	"fyne.io/fyne/v2/layout"
 	"fyne.io/fyne/v2/widget"
+
+	"github/mr-joshcrane/hotkey/bwrep"
 )
 
-// Pattern holds a pattern with optional friendly name
+// Pattern holds a pattern with optional friendly name. ID stays the same
+// when the name or keys are edited, so stats follow the pattern.
 type Pattern struct {
-	Name    string
-	Pattern string
+	ID       string `json:"id,omitempty"`
+	Name     string `json:"name"`
+	Pattern  string `json:"pattern"`
+	Template string `json:"template,omitempty"` // ID of the template that generated it
 }
 
 // Default patterns (used if no file found)
 var defaultPatterns = []Pattern{
-	{"5 Group Cycle", "1a2a3a4a5a"},
-	{"4 Group Cycle", "1a2a3a4a"},
-	{"3 Group Cycle", "1a2a3a"},
-	{"F-Key Cycle", "F1aF2aF3a"},
-	{"Click Practice", "LCaRCa"},
+	{Name: "5 Group Cycle", Pattern: "1a2a3a4a5a"},
+	{Name: "4 Group Cycle", Pattern: "1a2a3a4a"},
+	{Name: "3 Group Cycle", Pattern: "1a2a3a"},
+	{Name: "4 Army Cycle", Pattern: "1aLC2aLC3aLC4aLC"},
+	{Name: "F-Key Cycle", Pattern: "F1aF2aF3a"},
+	{Name: "Click Practice", Pattern: "LCaRCa"},
 }
 
 // patternsFile is the config file name
@@ -40,49 +47,118 @@ const patternsFile = "keystroke_patterns.txt"
 
 // Key mappings for special keys
 var keyNames = map[fyne.KeyName]string{
-	fyne.KeyF1:     "F1",
-	fyne.KeyF2:     "F2",
-	fyne.KeyF3:     "F3",
-	fyne.KeyF4:     "F4",
-	fyne.KeyF5:     "F5",
-	fyne.KeyF6:     "F6",
-	fyne.KeyF7:     "F7",
-	fyne.KeyF8:     "F8",
-	fyne.KeyF9:     "F9",
-	fyne.KeyF10:    "F10",
-	fyne.KeyF11:    "F11",
-	fyne.KeyF12:    "F12",
-	fyne.KeyReturn: "Enter",
-	fyne.KeyEnter:  "Enter",
-	fyne.KeySpace:  " ",
-	fyne.KeyEscape: "ESC",
+	fyne.KeyF1:        "F1",
+	fyne.KeyF2:        "F2",
+	fyne.KeyF3:        "F3",
+	fyne.KeyF4:        "F4",
+	fyne.KeyF5:        "F5",
+	fyne.KeyF6:        "F6",
+	fyne.KeyF7:        "F7",
+	fyne.KeyF8:        "F8",
+	fyne.KeyF9:        "F9",
+	fyne.KeyF10:       "F10",
+	fyne.KeyF11:       "F11",
+	fyne.KeyF12:       "F12",
+	fyne.KeyReturn:    "ENTER",
+	fyne.KeyEnter:     "NUMENTER",
+	fyne.KeySpace:     "SPACE",
+	fyne.KeyEscape:    "ESC",
+	fyne.KeyTab:       "TAB",
+	fyne.KeyBackspace: "BKSP",
+	fyne.KeyInsert:    "INS",
+	fyne.KeyDelete:    "DEL",
+	fyne.KeyHome:      "HOME",
+	fyne.KeyEnd:       "END",
+	fyne.KeyPageUp:    "PGUP",
+	fyne.KeyPageDown:  "PGDN",
+	fyne.KeyUp:        "UP",
+	fyne.KeyDown:      "DOWN",
+	fyne.KeyLeft:      "LEFT",
+	fyne.KeyRight:     "RIGHT",
 }
 
 // Display icons for special inputs
 var displayIcons = map[string]string{
-	"LC":  "◐",
-	"RC":  "◑",
-	"MC":  "◉",
-	"SLC": "⇧◐",
-	"SRC": "⇧◑",
-	"F1":  "[F1]",
-	"F2":  "[F2]",
-	"F3":  "[F3]",
-	"F4":  "[F4]",
-	"F5":  "[F5]",
-	"F6":  "[F6]",
-	"F7":  "[F7]",
-	"F8":  "[F8]",
-	"F9":  "[F9]",
-	"F10": "[F10]",
-	"F11": "[F11]",
-	"F12": "[F12]",
+	"LC":       "◐",
+	"RC":       "◑",
+	"MC":       "◉",
+	"SLC":      "⇧◐",
+	"SRC":      "⇧◑",
+	"F1":       "[F1]",
+	"F2":       "[F2]",
+	"F3":       "[F3]",
+	"F4":       "[F4]",
+	"F5":       "[F5]",
+	"F6":       "[F6]",
+	"F7":       "[F7]",
+	"F8":       "[F8]",
+	"F9":       "[F9]",
+	"F10":      "[F10]",
+	"F11":      "[F11]",
+	"F12":      "[F12]",
+	"DRAG":     "▣",
+	"DLC":      "◐◐",
+	"DT1":      "⇈1",
+	"DT2":      "⇈2",
+	"DT3":      "⇈3",
+	"DT4":      "⇈4",
+	"DT5":      "⇈5",
+	"DT6":      "⇈6",
+	"DT7":      "⇈7",
+	"DT8":      "⇈8",
+	"DT9":      "⇈9",
+	"DT0":      "⇈0",
+	"ENTER":    "↵",
+	"NUMENTER": "[N↵]",
+	"SPACE":    "␣",
+	"TAB":      "⇥",
+	"BKSP":     "⌫",
+	"INS":      "[Ins]",
+	"DEL":      "⌦",
+	"HOME":     "⇱",
+	"END":      "⇲",
+	"PGUP":     "⇞",
+	"PGDN":     "⇟",
+	"UP":       "↑",
+	"DOWN":     "↓",
+	"LEFT":     "←",
+	"RIGHT":    "→",
+	"NUM0":     "[N0]",
+	"NUM1":     "[N1]",
+	"NUM2":     "[N2]",
+	"NUM3":     "[N3]",
+	"NUM4":     "[N4]",
+	"NUM5":     "[N5]",
+	"NUM6":     "[N6]",
+	"NUM7":     "[N7]",
+	"NUM8":     "[N8]",
+	"NUM9":     "[N9]",
+	"NUM.":     "[N.]",
+	"NUM/":     "[N/]",
+	"NUM*":     "[N*]",
+	"NUM-":     "[N-]",
+	"NUM+":     "[N+]",
+}
+
+// patternTokens lists the multi-character tokens, longest first so that
+// prefix matching never splits a token (F10 before F1, SLC before LC,
+// PGUP before UP)
+var patternTokens = []string{
+	"NUMENTER",
+	"ENTER", "SPACE", "RIGHT",
+	"DRAG", "BKSP", "HOME", "PGUP", "PGDN", "DOWN", "LEFT",
+	"NUM0", "NUM1", "NUM2", "NUM3", "NUM4", "NUM5", "NUM6", "NUM7", "NUM8", "NUM9",
+	"NUM.", "NUM/", "NUM*", "NUM-", "NUM+",
+	"DLC", "DT1", "DT2", "DT3", "DT4", "DT5", "DT6", "DT7", "DT8", "DT9", "DT0",
+	"SLC", "SRC", "F10", "F11", "F12", "TAB", "INS", "DEL", "END",
+	"LC", "RC", "MC", "UP",
+	"F1", "F2", "F3", "F4", "F5", "F6", "F7", "F8", "F9",
 }
 
 // formatForDisplay converts pattern codes to visual icons
 func formatForDisplay(s string) string {
 	result := s
-	for _, token := range []string{"SLC", "SRC", "F10", "F11", "F12", "LC", "RC", "MC", "F1", "F2", "F3", "F4", "F5", "F6", "F7", "F8", "F9"} {
+	for _, token := range patternTokens {
 		if icon, ok := displayIcons[token]; ok {
 			result = strings.ReplaceAll(result, token, icon)
 		}
@@ -92,11 +168,10 @@ func formatForDisplay(s string) string {
 
 // getExpectedKey extracts the key token at a given character position in a pattern
 func getExpectedKey(pattern string, charPos int) string {
-	tokens := []string{"SLC", "SRC", "F10", "F11", "F12", "LC", "RC", "MC", "F1", "F2", "F3", "F4", "F5", "F6", "F7", "F8", "F9"}
 	pos := 0
 	for pos < len(pattern) {
 		found := false
-		for _, token := range tokens {
+		for _, token := range patternTokens {
 			if strings.HasPrefix(pattern[pos:], token) {
 				if pos == charPos {
 					return token
@@ -118,21 +193,28 @@ func getExpectedKey(pattern string, charPos int) string {
 
 // loadPatterns loads patterns from the config file, or returns defaults
 func loadPatterns() []Pattern {
+	patterns, _ := locatePatterns()
+	return patterns
+}
+
+// locatePatterns returns the patterns in use and the file they came from,
+// which is patternsFile in the working directory for the defaults
+func locatePatterns() ([]Pattern, string) {
 	patterns, err := loadPatternsFromFile(patternsFile)
 	if err == nil && len(patterns) > 0 {
-		return patterns
+		return patterns, patternsFile
 	}
 
 	exePath, err := os.Executable()
 	if err == nil {
-		exeDir := filepath.Dir(exePath)
-		patterns, err = loadPatternsFromFile(filepath.Join(exeDir, patternsFile))
+		path := filepath.Join(filepath.Dir(exePath), patternsFile)
+		patterns, err = loadPatternsFromFile(path)
 		if err == nil && len(patterns) > 0 {
-			return patterns
+			return patterns, path
 		}
 	}
 
-	return defaultPatterns
+	return defaultPatterns, patternsFile
 }
 
 func loadPatternsFromFile(path string) ([]Pattern, error) {
@@ -149,16 +231,27 @@ func loadPatternsFromFile(path string) ([]Pattern, error) {
 		if line == "" || strings.HasPrefix(line, "#") {
 			continue
 		}
-		if parts := strings.SplitN(line, "|", 2); len(parts) == 2 {
-			patterns = append(patterns, Pattern{Name: parts[0], Pattern: parts[1]})
-		} else {
-			patterns = append(patterns, Pattern{Name: line, Pattern: line})
-		}
+		patterns = append(patterns, parsePatternLine(line))
 	}
 
 	return patterns, scanner.Err()
 }
 
+// parsePatternLine reads "Name|pattern|id", where the name and ID are
+// optional
+func parsePatternLine(line string) Pattern {
+	parts := strings.SplitN(line, "|", 3)
+	p := Pattern{Name: line, Pattern: line}
+	if len(parts) >= 2 {
+		p = Pattern{Name: parts[0], Pattern: parts[1]}
+	}
+	if len(parts) == 3 {
+		p.ID = strings.TrimSpace(parts[2])
+	}
+	p.ID = p.key()
+	return p
+}
+
 // Statistics types
 const statsFile = "keystroke_stats.json"
 
@@ -170,17 +263,38 @@ type Mistake struct {
 }
 
 type PatternStats struct {
-	Pattern       string        `json:"pattern"`
-	Name          string        `json:"name"`
-	TotalAttempts int           `json:"total_attempts"`
-	PerfectCount  int           `json:"perfect_count"`
-	TotalResets   int           `json:"total_resets"`
-	BestTime      time.Duration `json:"best_time"`
-	TotalTime     time.Duration `json:"total_time"`
-	CurrentStreak int           `json:"current_streak"`
-	BestStreak    int           `json:"best_streak"`
-	LastPracticed time.Time     `json:"last_practiced"`
-	Mistakes      []Mistake     `json:"mistakes"`
+	Pattern       string         `json:"pattern"`
+	Name          string         `json:"name"`
+	Template      string         `json:"template,omitempty"` // template a generated pattern came from
+	TotalAttempts int            `json:"total_attempts"`
+	PerfectCount  int            `json:"perfect_count"`
+	TotalResets   int            `json:"total_resets"`
+	TotalForgiven int            `json:"total_forgiven,omitempty"` // mistakes a forgiving policy let through
+	BestTime      time.Duration  `json:"best_time"`
+	TotalTime     time.Duration  `json:"total_time"`
+	CurrentStreak int            `json:"current_streak"`
+	BestStreak    int            `json:"best_streak"`
+	LastPracticed time.Time      `json:"last_practiced"`
+	MasteredAt    time.Time      `json:"mastered_at"` // first masteryStreak perfect runs in a row
+	Mistakes      []Mistake      `json:"mistakes"`
+	DragCount     int            `json:"drag_count"`
+	DragCoverage  float64        `json:"drag_coverage"`
+	Rhythm        *RhythmStats   `json:"rhythm,omitempty"`
+	Adaptive      *AdaptiveStats `json:"adaptive,omitempty"`
+	Recall        *RecallStats   `json:"recall,omitempty"` // memory mode runs
+	// BestSplits holds the time of each token in the BestTime run
+	BestSplits []time.Duration `json:"best_splits,omitempty"`
+	// Policies counts the attempts made under each mistake policy
+	Policies map[MistakePolicy]int `json:"policies,omitempty"`
+	// Mastery tracks mastery per profile, for each profile's weekly goal
+	Mastery map[string]*ProfileMastery `json:"mastery,omitempty"`
+}
+
+// ProfileMastery is one profile's run of perfect attempts on a pattern and
+// when it first reached masteryStreak
+type ProfileMastery struct {
+	Streak     int       `json:"streak"`
+	MasteredAt time.Time `json:"mastered_at,omitempty"`
 }
 
 type SessionRecord struct {
@@ -190,20 +304,29 @@ type SessionRecord struct {
 	PatternsTotal   int           `json:"patterns_total"`
 	PatternsPerfect int           `json:"patterns_perfect"`
 	Completed       bool          `json:"completed"`
+	Profile         string        `json:"profile,omitempty"`
 }
 
 type AllStats struct {
-	PatternStats   map[string]*PatternStats `json:"pattern_stats"`
+	Version        int                      `json:"version"`
+	PatternStats   map[string]*PatternStats `json:"pattern_stats"` // keyed by pattern ID
 	Sessions       []SessionRecord          `json:"sessions"`
 	TotalSessions  int                      `json:"total_sessions"`
 	TotalTrainTime time.Duration            `json:"total_train_time"`
 	LastUpdated    time.Time                `json:"last_updated"`
+	Builds         map[string]*BuildStats   `json:"builds,omitempty"`
+	Multitask      *MultitaskStats          `json:"multitask,omitempty"`
+	Daily          map[string]*DailyStats   `json:"daily,omitempty"`        // keyed by profile
+	Achievements   map[string]time.Time     `json:"achievements,omitempty"` // unlock time by achievement ID
+
+	path string // file the stats are saved to; empty keeps them in memory
 }
 
 func loadStats() *AllStats {
 	stats := &AllStats{
 		PatternStats: make(map[string]*PatternStats),
 		Sessions:     []SessionRecord{},
+		path:         statsFile,
 	}
 
 	data, err := os.ReadFile(statsFile)
@@ -219,44 +342,69 @@ func loadStats() *AllStats {
 }
 
 func (s *AllStats) save() error {
+	if s.path == "" {
+		return nil
+	}
 	s.LastUpdated = time.Now()
 	data, err := json.MarshalIndent(s, "", "  ")
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(statsFile, data, 0644)
+	return os.WriteFile(s.path, data, 0644)
 }
 
 func (s *AllStats) getPatternStats(pattern Pattern) *PatternStats {
-	if ps, ok := s.PatternStats[pattern.Pattern]; ok {
-		return ps
-	}
-	ps := &PatternStats{
-		Pattern: pattern.Pattern,
-		Name:    pattern.Name,
+	ps, ok := s.PatternStats[pattern.key()]
+	if !ok {
+		ps = &PatternStats{}
+		s.PatternStats[pattern.key()] = ps
 	}
-	s.PatternStats[pattern.Pattern] = ps
+	// Follow renames and edits
+	ps.Pattern = pattern.Pattern
+	ps.Name = pattern.Name
+	ps.Template = pattern.Template
 	return ps
 }
 
-func (s *AllStats) recordAttempt(pattern Pattern, elapsed time.Duration, resets int) {
+func (s *AllStats) recordAttempt(pattern Pattern, profile string, elapsed time.Duration, resets, forgiven int, policy MistakePolicy) {
 	ps := s.getPatternStats(pattern)
 	ps.TotalAttempts++
 	ps.TotalTime += elapsed
 	ps.TotalResets += resets
+	ps.TotalForgiven += forgiven
 	ps.LastPracticed = time.Now()
+	if ps.Policies == nil {
+		ps.Policies = make(map[MistakePolicy]int)
+	}
+	ps.Policies[policy]++
+	if ps.Mastery == nil {
+		ps.Mastery = make(map[string]*ProfileMastery)
+	}
+	mastery := ps.Mastery[profile]
+	if mastery == nil {
+		mastery = &ProfileMastery{}
+		ps.Mastery[profile] = mastery
+	}
 
-	if resets == 0 {
+	if resets == 0 && forgiven == 0 {
 		ps.PerfectCount++
 		ps.CurrentStreak++
 		if ps.CurrentStreak > ps.BestStreak {
 			ps.BestStreak = ps.CurrentStreak
 		}
+		if ps.CurrentStreak == masteryStreak && ps.MasteredAt.IsZero() {
+			ps.MasteredAt = time.Now()
+		}
+		mastery.Streak++
+		if mastery.Streak == masteryStreak && mastery.MasteredAt.IsZero() {
+			mastery.MasteredAt = time.Now()
+		}
 		if ps.BestTime == 0 || elapsed < ps.BestTime {
 			ps.BestTime = elapsed
 		}
 	} else {
 		ps.CurrentStreak = 0
+		mastery.Streak = 0
 	}
 }
 
@@ -274,11 +422,17 @@ func (s *AllStats) recordMistake(pattern Pattern, position int, expected, actual
 	}
 }
 
+func (s *AllStats) recordDrag(pattern Pattern, coverage float64) {
+	ps := s.getPatternStats(pattern)
+	ps.DragCount++
+	ps.DragCoverage += coverage
+}
+
 func (s *AllStats) startSession() time.Time {
 	return time.Now()
 }
 
-func (s *AllStats) endSession(startTime time.Time, total, perfect int, completed bool) {
+func (s *AllStats) endSession(startTime time.Time, total, perfect int, completed bool, profile string) {
 	endTime := time.Now()
 	duration := endTime.Sub(startTime)
 
@@ -289,6 +443,7 @@ func (s *AllStats) endSession(startTime time.Time, total, perfect int, completed
 		PatternsTotal:   total,
 		PatternsPerfect: perfect,
 		Completed:       completed,
+		Profile:         profile,
 	}
 	s.Sessions = append(s.Sessions, session)
 	s.TotalSessions++
@@ -313,14 +468,24 @@ type App struct {
 	clickGrid      [16]*canvas.Rectangle
 	clickGridTexts [16]*canvas.Text
 	activeCell     int // -1 means no active cell
+	gridCells      [16]*GridCell
 	expectedClick  string
 	gridContainer  *fyne.Container
 
+	// Box-drag selection over the grid
+	dragBox    *canvas.Rectangle
+	dragLayer  *fyne.Container
+	dragTarget dragTarget
+	dragStart  fyne.Position
+	dragArmed  bool
+	dragMoved  bool
+
 	// Main container that captures input
 	mainContainer *FullWindowInput
 
-	// All loaded patterns
+	// All loaded patterns, and the templates generated ones come from
 	allPatterns  []Pattern
+	templates    []Template
 	patternQueue []Pattern
 	currentIndex int
 
@@ -330,14 +495,72 @@ type App struct {
 	inSession      bool
 	startTime      time.Time
 	resetCount     int
+	forgiven       int           // mistakes the policy let through without a reset
+	penalty        time.Duration // time added under the penalty policy
+	wrongInput     bool          // a mistake waits to be erased under the backspace policy
+	pendingDouble  time.Time     // first half of a double-tap/double-click
+	tokenSplits    []time.Duration
+
+	// Ghost cursor racing the personal best
+	ghostCursor *canvas.Rectangle
+	ghostStop   chan struct{}
 
 	// Session stats
 	sessionPerfect int
 	sessionTotal   int
+	sessionDropped int // failed patterns not requeued
 	sessionStart   time.Time
 
 	// Persistent stats
 	stats *AllStats
+
+	settings  *Settings
+	palette   *Palette
+	audio     *Audio
+	metronome *metronome // set while a metronome-mode pattern is running
+
+	buildOrders []BuildOrder
+	build       *buildRun // set while a build-order session is running
+
+	// Team leaderboard sync, if a server is configured
+	leaderboard *leaderboard
+
+	// Adaptive version of the current pattern, in adaptive mode
+	adaptive *adaptiveRun
+	// Flash of the current pattern, in memory mode
+	memory *memoryRun
+
+	// Daily challenge, while one is being played
+	daily *dailyRun
+
+	// Day the practice reminder was last sent
+	reminded string
+
+	// Achievement toast over the top of the window, and the gallery
+	// window while open
+	toastBox   *fyne.Container
+	toastText  *canvas.Text
+	toastShown int // toasts shown so far, so an old one's timer leaves a newer one up
+	gallery    fyne.Window
+
+	// Pattern editor window, while open
+	editor *editor
+
+	// LAN race, if hosting or joined
+	race     *race
+	boardBox *fyne.Container
+
+	// Interrupt lanes beside the main pattern in multitask mode
+	multitask   *multitask
+	laneDisplay *canvas.Text
+
+	// Session recording and playback
+	rng         *rand.Rand // seeded per session so replays repeat it exactly
+	clock       func() time.Time
+	recorder    *recorder
+	lastOutcome string
+	playback    bool // this App is a replay viewer
+	player      *replayPlayer
 }
 
 // GridCell is a clickable cell in the grid
@@ -350,11 +573,11 @@ type GridCell struct {
 }
 
 func NewGridCell(app *App, index int) *GridCell {
-	rect := canvas.NewRectangle(color.RGBA{40, 40, 50, 255})
+	rect := canvas.NewRectangle(app.palette.Cell)
 	rect.SetMinSize(fyne.NewSize(70, 50))
 	rect.CornerRadius = 4
 
-	txt := canvas.NewText("", color.White)
+	txt := canvas.NewText("", app.palette.CellText)
 	txt.TextSize = 12
 	txt.TextStyle = fyne.TextStyle{Bold: true}
 	txt.Alignment = fyne.TextAlignCenter
@@ -374,44 +597,72 @@ func (gc *GridCell) CreateRenderer() fyne.WidgetRenderer {
 }
 
 var _ desktop.Mouseable = (*GridCell)(nil)
+var _ fyne.Draggable = (*GridCell)(nil)
 
 func (gc *GridCell) MouseDown(e *desktop.MouseEvent) {
-	if !gc.app.isActive || gc.app.expectedClick == "" {
+	if gc.app.playback || !gc.app.isActive {
 		return
 	}
 
+	// A box-drag starts with a plain primary press anywhere on the grid
+	if gc.app.expectedClick == "DRAG" && e.Button == desktop.MouseButtonPrimary {
+		gc.app.beginDrag(e.AbsolutePosition)
+		return
+	}
+
+	clickType := clickToken(e)
+	if clickType == "" {
+		return
+	}
+
+	// With no click expected the grid is only live for interrupts
+	if gc.app.expectedClick == "" {
+		if gc.app.laneExpects(clickType) {
+			gc.app.pressKey(clickType)
+		}
+		return
+	}
+
+	gc.app.gridClick(gc.cellIndex, clickType)
+}
+
+// clickToken names a mouse press as a pattern token, or "" for other buttons
+func clickToken(e *desktop.MouseEvent) string {
 	shift := e.Modifier&fyne.KeyModifierShift != 0
 
-	var clickType string
 	switch e.Button {
 	case desktop.MouseButtonPrimary:
 		if shift {
-			clickType = "SLC"
-		} else {
-			clickType = "LC"
+			return "SLC"
 		}
+		return "LC"
 	case desktop.MouseButtonSecondary:
 		if shift {
-			clickType = "SRC"
-		} else {
-			clickType = "RC"
+			return "SRC"
 		}
+		return "RC"
 	case desktop.MouseButtonTertiary:
-		clickType = "MC"
-	default:
-		return
+		return "MC"
 	}
+	return ""
+}
 
-	// Check if correct cell AND correct click type
-	if gc.cellIndex == gc.app.activeCell && clickType == gc.app.expectedClick {
-		gc.app.addKey(clickType)
-	} else {
-		// Wrong cell or wrong click type
-		gc.app.handleWrongGridClick(clickType, gc.cellIndex)
+func (gc *GridCell) MouseUp(e *desktop.MouseEvent) {
+	// Released without moving: a click where a box-drag was expected
+	if gc.app.dragArmed && !gc.app.dragMoved {
+		gc.app.dragMiss()
 	}
 }
 
-func (gc *GridCell) MouseUp(e *desktop.MouseEvent) {}
+// Dragged extends the selection box while the button is held
+func (gc *GridCell) Dragged(e *fyne.DragEvent) {
+	gc.app.updateDrag(e.AbsolutePosition)
+}
+
+// DragEnd scores the finished selection box
+func (gc *GridCell) DragEnd() {
+	gc.app.endDrag()
+}
 
 // FullWindowInput captures all input for the entire window
 type FullWindowInput struct {
@@ -420,12 +671,13 @@ type FullWindowInput struct {
 	focused    bool
 	background *canvas.Rectangle
 	content    fyne.CanvasObject
+	numpadKey  string // numpad token waiting for its TypedRune
 }
 
 func NewFullWindowInput(app *App, content fyne.CanvasObject) *FullWindowInput {
 	fw := &FullWindowInput{
 		app:        app,
-		background: canvas.NewRectangle(color.RGBA{25, 25, 35, 255}),
+		background: canvas.NewRectangle(app.palette.Background),
 		content:    content,
 	}
 	fw.ExtendBaseWidget(fw)
@@ -488,6 +740,11 @@ func (fw *FullWindowInput) Focused() bool {
 	return fw.focused
 }
 
+// AcceptsTab keeps Tab as a trainable key instead of a focus change
+func (fw *FullWindowInput) AcceptsTab() bool {
+	return true
+}
+
 // Tappable interface
 func (fw *FullWindowInput) Tapped(e *fyne.PointEvent) {
 	fw.app.window.Canvas().Focus(fw)
@@ -495,6 +752,11 @@ func (fw *FullWindowInput) Tapped(e *fyne.PointEvent) {
 
 // TypedKey handles special keys
 func (fw *FullWindowInput) TypedKey(key *fyne.KeyEvent) {
+	if fw.app.player != nil {
+		fw.app.player.typedKey(key.Name)
+		return
+	}
+
 	// ESC stops the session
 	if key.Name == fyne.KeyEscape && fw.app.inSession {
 		fw.app.stopSession()
@@ -507,24 +769,47 @@ func (fw *FullWindowInput) TypedKey(key *fyne.KeyEvent) {
 		return
 	}
 
-	if !fw.app.isActive {
+	if !fw.app.takingInput() {
 		return
 	}
 
+	// Numpad digits and operators share key names with the main keyboard,
+	// so they are told apart by scan code and claimed by the next TypedRune
+	fw.numpadKey = numpadToken(key.Physical.ScanCode)
+
 	// Map special keys
 	if name, ok := keyNames[key.Name]; ok {
-		if name != "ESC" && name != "Enter" {
-			fw.app.addKey(name)
+		if name != "ESC" {
+			fw.app.pressKey(fw.app.settings.activeProfile().translate(name))
 		}
 	}
 }
 
 // TypedRune handles regular character input
 func (fw *FullWindowInput) TypedRune(r rune) {
-	if !fw.app.isActive {
+	if fw.app.player != nil {
+		fw.app.player.typedRune(r)
+		return
+	}
+	if !fw.app.inSession {
+		fw.app.handleIdleRune(r)
+		return
+	}
+	if !fw.app.takingInput() {
+		return
+	}
+
+	// Space arrives as SPACE through TypedKey
+	if r == ' ' {
 		return
 	}
-	fw.app.addKey(string(r))
+
+	key := string(r)
+	if fw.numpadKey != "" {
+		key = fw.numpadKey
+		fw.numpadKey = ""
+	}
+	fw.app.pressKey(fw.app.settings.activeProfile().translate(key))
 }
 
 // MouseDown handles mouse clicks
@@ -533,95 +818,228 @@ var _ desktop.Mouseable = (*FullWindowInput)(nil)
 func (fw *FullWindowInput) MouseDown(e *desktop.MouseEvent) {
 	fw.app.window.Canvas().Focus(fw)
 
-	if !fw.app.isActive {
+	if fw.app.playback || !fw.app.takingInput() {
+		return
+	}
+
+	clickType := clickToken(e)
+	if clickType == "" {
 		return
 	}
 
-	// If a click is expected, it must be on the grid - ignore clicks elsewhere
-	if fw.app.expectedClick != "" {
+	// If a click is expected, it must be on the grid - ignore clicks
+	// elsewhere unless an interrupt wants them
+	if fw.app.expectedClick != "" && !fw.app.laneExpects(clickType) {
 		return
 	}
 
 	// No click expected - this is a wrong click (keyboard was expected)
-	shift := e.Modifier&fyne.KeyModifierShift != 0
+	fw.app.pressKey(clickType)
+}
 
-	var clickType string
-	switch e.Button {
-	case desktop.MouseButtonPrimary:
-		if shift {
-			clickType = "SLC"
-		} else {
-			clickType = "LC"
+func (fw *FullWindowInput) MouseUp(e *desktop.MouseEvent) {}
+
+func main() {
+	replayPath := flag.String("replay", "", "play back a recorded session file")
+	importRep := flag.Bool("import-rep", false, "print patterns mined from the Brood War replays given as arguments")
+	importPlayer := flag.String("player", "", "replay player to mine with -import-rep")
+	importTop := flag.Int("top", 10, "number of patterns to mine with -import-rep")
+	hostAddr := flag.String("host", "", "host a LAN race on this address, e.g. :7777")
+	joinAddr := flag.String("join", "", "join the LAN race hosted at this address, e.g. 192.168.1.10:7777")
+	raceAs := flag.String("name", "", "your name on the race leaderboard (default: player_name, or your login)")
+	importPackPath := flag.String("import-pack", "", "add the patterns from a pack file to keystroke_patterns.txt")
+	exportPackPath := flag.String("export-pack", "", "write the loaded patterns to a pack file")
+	var pack Pack
+	flag.StringVar(&pack.Name, "pack-name", "", "name of the exported pack (default: the file name)")
+	flag.StringVar(&pack.Author, "pack-author", "", "author of the exported pack")
+	flag.StringVar(&pack.Race, "pack-race", "", "race the exported pack is for")
+	flag.StringVar(&pack.Version, "pack-version", "1", "version of the exported pack")
+	flag.StringVar(&pack.Description, "pack-description", "", "description of the exported pack")
+	exportDir := flag.String("export-stats", "", "write stats as CSV and JSON Lines, with a report per profile, to this directory")
+	generate := flag.Int("generate", 0, "print this many patterns from each template")
+	generateSeed := flag.Int64("seed", 0, "seed for -generate (default: random)")
+	flag.Parse()
+
+	if *generate > 0 {
+		seed := *generateSeed
+		if seed == 0 {
+			seed = time.Now().UnixNano()
 		}
-	case desktop.MouseButtonSecondary:
-		if shift {
-			clickType = "SRC"
-		} else {
-			clickType = "RC"
+		if err := printGenerated(os.Stdout, loadTemplates(), *generate, seed); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
 		}
-	case desktop.MouseButtonTertiary:
-		clickType = "MC"
-	default:
 		return
 	}
 
-	fw.app.addKey(clickType)
-}
+	if *exportDir != "" {
+		stats := loadStats()
+		stats.migrate(loadPatterns())
+		settings := loadSettings()
+		// loadPalette falls back to dark when the theme can't be read
+		palette, err := loadPalette(settings)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		files, err := exportStats(stats, *exportDir, settings.profileName(), palette)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		for _, path := range files {
+			fmt.Println(path)
+		}
+		return
+	}
 
-func (fw *FullWindowInput) MouseUp(e *desktop.MouseEvent) {}
+	if *importPackPath != "" || *exportPackPath != "" {
+		var err error
+		if *importPackPath != "" {
+			err = importPack(os.Stdout, *importPackPath)
+		} else {
+			err = exportPack(os.Stdout, *exportPackPath, pack)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *importRep {
+		err := bwrep.Import(os.Stdout, flag.Args(), *importPlayer, *importTop, loadSettings().doubleInterval())
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
 
-func main() {
 	a := app.NewWithID("com.buildorder.keystroketrainer")
+
+	if *replayPath != "" {
+		w, err := openReplay(a, *replayPath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		w.ShowAndRun()
+		return
+	}
+
 	w := a.NewWindow("⌨️ Keystroke Trainer")
 	w.Resize(fyne.NewSize(700, 450))
 
+	settings := loadSettings()
+	palette, err := loadPalette(settings)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+	a.Settings().SetTheme(palette.fyneTheme())
+	// Give lines without an ID the one they're about to be loaded with
+	_, patternsPath := locatePatterns()
+	if err := pinPatternIDs(patternsPath); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
 	myApp := &App{
 		window:      w,
 		allPatterns: loadPatterns(),
+		templates:   loadTemplates(),
+		buildOrders: loadBuildOrders(),
 		stats:       loadStats(),
+		settings:    settings,
+		palette:     palette,
+		audio:       newAudio(settings),
+	}
+
+	myApp.stats.migrate(myApp.allPatterns)
+	// Milestones reached before achievements existed unlock quietly
+	if len(myApp.stats.unlockAchievements(time.Now())) > 0 {
+		myApp.stats.save()
+	}
+
+	switch player := settings.playerName(); {
+	case settings.LeaderboardURL == "":
+	case player == "":
+		fmt.Fprintln(os.Stderr, "leaderboard: set player_name in the settings to sync best times")
+	default:
+		myApp.leaderboard = newLeaderboard(settings.LeaderboardURL, player, myApp.allPatterns)
+	}
+
+	if *raceAs == "" {
+		*raceAs = raceName(settings)
+	}
+	switch {
+	case *hostAddr != "":
+		myApp.race, err = hostRace(myApp, *hostAddr, *raceAs)
+	case *joinAddr != "":
+		myApp.race, err = joinRace(myApp, *joinAddr, *raceAs)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
 
 	myApp.setupUI()
+	myApp.startReminders()
+	// Closing the window mid-session stops it first, which finishes the
+	// replay file and saves the session
+	w.SetCloseIntercept(func() {
+		if myApp.inSession {
+			myApp.stopSession()
+		}
+		w.Close()
+	})
 	w.ShowAndRun()
 }
 
 func (app *App) setupUI() {
 	// Pattern name - large and prominent
-	app.patternName = canvas.NewText("", color.RGBA{100, 180, 255, 255})
+	app.patternName = canvas.NewText("", app.palette.Info)
 	app.patternName.TextSize = 28
 	app.patternName.TextStyle = fyne.TextStyle{Bold: true}
 	app.patternName.Alignment = fyne.TextAlignCenter
 
 	// Best time motivation
-	app.bestTimeLabel = canvas.NewText("", color.RGBA{150, 150, 150, 255})
+	app.bestTimeLabel = canvas.NewText("", app.palette.Muted)
 	app.bestTimeLabel.TextSize = 16
 	app.bestTimeLabel.Alignment = fyne.TextAlignCenter
 
 	// Target display - THE MAIN FOCUS
-	app.targetDisplay = canvas.NewText("", color.RGBA{80, 220, 120, 255})
-	app.targetDisplay.TextSize = 56
+	app.targetDisplay = canvas.NewText("", app.palette.Target)
+	app.targetDisplay.TextSize = app.settings.targetTextSize()
 	app.targetDisplay.TextStyle = fyne.TextStyle{Monospace: true, Bold: true}
 	app.targetDisplay.Alignment = fyne.TextAlignCenter
 
+	// Ghost cursor drawn over the target at personal best pace
+	app.ghostCursor = canvas.NewRectangle(app.palette.Ghost)
+	app.ghostCursor.Hide()
+
 	// Input display - what user has typed
-	app.inputDisplay = canvas.NewText("", color.RGBA{200, 200, 200, 255})
-	app.inputDisplay.TextSize = 56
+	app.inputDisplay = canvas.NewText("", app.palette.Input)
+	app.inputDisplay.TextSize = app.settings.inputTextSize()
 	app.inputDisplay.TextStyle = fyne.TextStyle{Monospace: true}
 	app.inputDisplay.Alignment = fyne.TextAlignCenter
 
+	// Raised interrupts in multitask mode
+	app.laneDisplay = canvas.NewText("", app.palette.Lane)
+	app.laneDisplay.TextSize = 22
+	app.laneDisplay.TextStyle = fyne.TextStyle{Bold: true}
+	app.laneDisplay.Alignment = fyne.TextAlignCenter
+
 	// Status feedback
-	app.statusLabel = canvas.NewText("", color.RGBA{255, 255, 255, 255})
+	app.statusLabel = canvas.NewText("", app.palette.Text)
 	app.statusLabel.TextSize = 24
 	app.statusLabel.TextStyle = fyne.TextStyle{Bold: true}
 	app.statusLabel.Alignment = fyne.TextAlignCenter
 
 	// Progress
-	app.progressLabel = canvas.NewText("", color.RGBA{150, 150, 180, 255})
+	app.progressLabel = canvas.NewText("", app.palette.Progress)
 	app.progressLabel.TextSize = 18
 	app.progressLabel.Alignment = fyne.TextAlignCenter
 
 	// Hint at bottom
-	app.hintLabel = canvas.NewText("Press SPACE to start • ESC to stop", color.RGBA{80, 80, 100, 255})
+	app.hintLabel = canvas.NewText("Press SPACE to start • ESC to stop", app.palette.Hint)
 	app.hintLabel.TextSize = 14
 	app.hintLabel.Alignment = fyne.TextAlignCenter
 
@@ -630,12 +1048,24 @@ func (app *App) setupUI() {
 	gridCells := make([]fyne.CanvasObject, 16)
 	for i := 0; i < 16; i++ {
 		gc := NewGridCell(app, i)
+		app.gridCells[i] = gc
 		app.clickGrid[i] = gc.rect
 		app.clickGridTexts[i] = gc.text
 		gridCells[i] = gc
 	}
 	app.gridContainer = container.NewGridWithColumns(4, gridCells...)
 
+	// Selection box drawn over the grid while dragging
+	app.dragBox = canvas.NewRectangle(app.palette.Target.withAlpha(40))
+	app.dragBox.StrokeColor = app.palette.Target
+	app.dragBox.StrokeWidth = 2
+	app.dragBox.Hide()
+	app.dragLayer = container.NewWithoutLayout(app.dragBox)
+
+	// Race leaderboard, shown once hosting or joined
+	app.boardBox = container.NewVBox()
+	app.boardBox.Hide()
+
 	// Initial state
 	app.showIdleState()
 
@@ -645,9 +1075,10 @@ func (app *App) setupUI() {
 		container.NewCenter(app.patternName),
 		container.NewCenter(app.bestTimeLabel),
 		layout.NewSpacer(),
-		container.NewCenter(app.targetDisplay),
+		container.NewStack(container.NewCenter(app.targetDisplay), container.NewWithoutLayout(app.ghostCursor)),
 		container.NewPadded(container.NewCenter(app.inputDisplay)),
-		container.NewCenter(app.gridContainer),
+		container.NewCenter(app.laneDisplay),
+		container.NewCenter(container.NewStack(app.gridContainer, app.dragLayer)),
 		layout.NewSpacer(),
 		container.NewCenter(app.statusLabel),
 		container.NewCenter(app.progressLabel),
@@ -655,8 +1086,16 @@ func (app *App) setupUI() {
 		container.NewCenter(app.hintLabel),
 	)
 
+	// Ctrl+M toggles sound at any time
+	app.window.Canvas().AddShortcut(&desktop.CustomShortcut{KeyName: fyne.KeyM, Modifier: fyne.KeyModifierShortcutDefault}, func(fyne.Shortcut) {
+		app.toggleMute()
+	})
+
 	// Wrap in full-window input capture
-	app.mainContainer = NewFullWindowInput(app, container.NewPadded(content))
+	app.mainContainer = NewFullWindowInput(app, container.NewPadded(container.NewStack(
+		container.NewBorder(nil, nil, nil, app.boardBox, content),
+		app.newToast(),
+	)))
 	app.window.SetContent(app.mainContainer)
 
 	// Auto-focus on show
@@ -665,10 +1104,14 @@ func (app *App) setupUI() {
 
 func (app *App) showIdleState() {
 	app.patternName.Text = "⌨️ Keystroke Trainer"
-	app.patternName.Color = color.RGBA{100, 180, 255, 255}
+	app.patternName.Color = app.palette.Info
 	app.patternName.Refresh()
 
-	app.bestTimeLabel.Text = fmt.Sprintf("%d patterns loaded", len(app.allPatterns))
+	mode := modeLabels[app.mode()]
+	if app.mode() == modeBuild {
+		mode += ": " + app.buildOrder().Name
+	}
+	app.bestTimeLabel.Text = fmt.Sprintf("%d patterns loaded • %s (%s) • %s", len(app.allPatterns), app.settings.profileName(), strings.ToUpper(app.settings.activeProfile().Layout), mode)
 	app.bestTimeLabel.Refresh()
 
 	app.targetDisplay.Text = ""
@@ -678,55 +1121,102 @@ func (app *App) showIdleState() {
 	app.inputDisplay.Refresh()
 
 	app.statusLabel.Text = "Click anywhere to focus"
-	app.statusLabel.Color = color.RGBA{150, 150, 150, 255}
+	app.statusLabel.Color = app.palette.Muted
 	app.statusLabel.Refresh()
 
-	app.progressLabel.Text = ""
+	app.progressLabel.Text = app.goalProgress()
+	app.progressLabel.Color = app.palette.Progress
 	app.progressLabel.Refresh()
 
-	app.hintLabel.Text = "Press SPACE to start • ESC to stop"
+	app.hintLabel.Text = "Press SPACE to start • ESC to stop • M mode • G source • D daily • B build • R replay • E edit • X export • A achievements • Ctrl+M sound"
+	switch {
+	case app.race != nil && app.race.host:
+		app.hintLabel.Text = fmt.Sprintf("Hosting a race on %s • SPACE starts it for everyone", app.race.addr)
+	case app.race != nil:
+		app.hintLabel.Text = fmt.Sprintf("Joined the race at %s • waiting for the host to start", app.race.addr)
+	}
 	app.hintLabel.Refresh()
 }
 
-func (app *App) shufflePatterns() {
-	app.patternQueue = make([]Pattern, len(app.allPatterns))
-	copy(app.patternQueue, app.allPatterns)
+func (app *App) toggleMute() {
+	if app.playback {
+		return
+	}
+	app.settings.Muted = !app.settings.Muted
+	app.settings.save()
 
-	rand.Shuffle(len(app.patternQueue), func(i, j int) {
-		app.patternQueue[i], app.patternQueue[j] = app.patternQueue[j], app.patternQueue[i]
-	})
+	if app.settings.Muted {
+		app.statusLabel.Text = "🔇 Sound off"
+	} else {
+		app.statusLabel.Text = "🔊 Sound on"
+	}
+	app.statusLabel.Color = app.palette.Muted
+	app.statusLabel.Refresh()
 }
 
 func (app *App) startSession() {
-	app.shufflePatterns()
+	// In a race only the host starts, for everyone
+	if app.race != nil && !app.race.host {
+		app.raceStatus("Waiting for the host to start the race", app.palette.Muted)
+		return
+	}
+	seed := time.Now().UnixNano()
+	app.race.begin(seed, app.allPatterns)
+	app.launchSession(seed)
+}
+
+// launchSession starts a recorded session from the given seed
+func (app *App) launchSession(seed int64) {
+	app.beginSession(seed)
+	app.startRecording(seed)
+	app.nextPattern()
+}
+
+// beginSession resets the session state; the seed fixes pattern order and
+// click cells so a replay can repeat them
+func (app *App) beginSession(seed int64) {
+	app.rng = rand.New(rand.NewSource(seed))
+	app.composeSession()
 	app.currentIndex = 0
 	app.inSession = true
 	app.sessionPerfect = 0
 	app.sessionTotal = 0
 	app.sessionStart = app.stats.startSession()
+	switch app.mode() {
+	case modeBuild:
+		app.beginBuild()
+	case modeMultitask:
+		app.beginMultitask()
+	}
 
 	app.hintLabel.Text = "ESC to stop session"
 	app.hintLabel.Refresh()
 
 	app.window.Canvas().Focus(app.mainContainer)
-	app.nextPattern()
 }
 
 func (app *App) stopSession() {
+	defer app.checkAchievements()
 	app.inSession = false
 	app.isActive = false
+	app.stopMetronome()
+	app.stopBuild()
+	app.stopGhost()
+	app.stopRecording("stop")
+	app.race.report(raceMsg{Type: "quit"})
 
-	app.stats.endSession(app.sessionStart, app.sessionTotal, app.sessionPerfect, false)
+	app.stats.endSession(app.sessionStart, app.sessionTotal, app.sessionPerfect, false, app.settings.profileName())
 
 	app.statusLabel.Text = fmt.Sprintf("Session ended: %d/%d perfect", app.sessionPerfect, app.sessionTotal)
-	app.statusLabel.Color = color.RGBA{200, 200, 100, 255}
+	app.statusLabel.Color = app.palette.Ended
 	app.statusLabel.Refresh()
 
-	app.progressLabel.Text = ""
+	app.progressLabel.Text = app.goalProgress()
+	app.progressLabel.Color = app.palette.Progress
 	app.progressLabel.Refresh()
 
 	app.patternName.Text = "Session Stopped"
-	app.patternName.Color = color.RGBA{200, 150, 100, 255}
+	app.patternName.Color = app.palette.Stopped
 	app.patternName.Refresh()
 
 	app.bestTimeLabel.Text = ""
@@ -740,18 +1230,33 @@ func (app *App) stopSession() {
 
 	app.hintLabel.Text = "Press SPACE to start new session"
 	app.hintLabel.Refresh()
+
+	app.finishMultitask()
+	app.finishDaily(false)
 }
 
 func (app *App) sessionComplete() {
+	defer app.checkAchievements()
 	app.inSession = false
 	app.isActive = false
 
-	app.stats.endSession(app.sessionStart, app.sessionTotal, app.sessionPerfect, true)
+	app.stopRecording("end")
+	app.race.report(raceMsg{Type: "finish"})
+	app.stats.endSession(app.sessionStart, app.sessionTotal, app.sessionPerfect, true, app.settings.profileName())
+
+	elapsed := app.now().Sub(app.sessionStart)
 
-	elapsed := time.Since(app.sessionStart)
+	if app.build != nil {
+		app.finishBuild()
+		return
+	}
 
 	app.patternName.Text = "🏆 ALL PATTERNS MASTERED!"
-	app.patternName.Color = color.RGBA{255, 215, 0, 255}
+	app.patternName.Color = app.palette.Best
+	if app.sessionDropped > 0 {
+		app.patternName.Text = "🏁 Session complete"
+		app.patternName.Color = app.palette.Info
+	}
 	app.patternName.Refresh()
 
 	app.bestTimeLabel.Text = fmt.Sprintf("Session time: %v", elapsed.Round(time.Second))
@@ -763,21 +1268,27 @@ func (app *App) sessionComplete() {
 	app.inputDisplay.Text = ""
 	app.inputDisplay.Refresh()
 
-	app.statusLabel.Text = fmt.Sprintf("%d patterns completed perfectly", len(app.allPatterns))
-	app.statusLabel.Color = color.RGBA{100, 255, 100, 255}
+	app.statusLabel.Text = fmt.Sprintf("%d patterns completed perfectly", app.sessionPerfect)
+	app.statusLabel.Color = app.palette.Success
 	app.statusLabel.Refresh()
 
-	app.progressLabel.Text = ""
+	app.progressLabel.Text = app.goalProgress()
+	app.progressLabel.Color = app.palette.Progress
 	app.progressLabel.Refresh()
 
 	app.hintLabel.Text = "Press SPACE to train again"
 	app.hintLabel.Refresh()
+
+	app.finishMultitask()
+	app.finishDaily(true)
+	app.audio.play(soundSessionComplete)
 }
 
 func (app *App) nextPattern() {
 	if !app.inSession {
 		return
 	}
+	app.record(replayEvent{Kind: "next", Cell: -1})
 
 	if len(app.patternQueue) == 0 {
 		app.sessionComplete()
@@ -786,42 +1297,74 @@ func (app *App) nextPattern() {
 
 	app.currentPattern = app.patternQueue[0]
 	app.patternQueue = app.patternQueue[1:]
+	app.adaptive = nil
+	if app.mode() == modeAdaptive {
+		app.adaptPattern()
+	}
+	app.memory = nil
+	if app.mode() == modeMemory {
+		app.startFlash()
+	}
 
 	app.inputBuffer = []string{}
 	app.resetCount = 0
+	app.forgiven = 0
+	app.penalty = 0
+	app.wrongInput = false
+	app.pendingDouble = time.Time{}
+	app.tokenSplits = nil
+	app.stopGhost()
 	app.isActive = true
 	app.startTime = time.Time{}
 
 	// Update displays
 	app.patternName.Text = app.currentPattern.Name
-	app.patternName.Color = color.RGBA{100, 180, 255, 255}
+	app.patternName.Color = app.palette.Info
 	app.patternName.Refresh()
 
 	// Show best time if exists
-	if ps, ok := app.stats.PatternStats[app.currentPattern.Pattern]; ok && ps.BestTime > 0 {
+	if ps, ok := app.stats.PatternStats[app.currentPattern.key()]; ok && ps.BestTime > 0 {
 		app.bestTimeLabel.Text = fmt.Sprintf("Best: %v", ps.BestTime.Round(time.Millisecond))
-		app.bestTimeLabel.Color = color.RGBA{255, 215, 0, 255}
+		app.bestTimeLabel.Color = app.palette.Best
 	} else {
 		app.bestTimeLabel.Text = "No record yet"
-		app.bestTimeLabel.Color = color.RGBA{100, 100, 100, 255}
+		app.bestTimeLabel.Color = app.palette.Dim
+	}
+	app.bestTimeLabel.Text += app.templateNote()
+	if app.memory != nil {
+		app.bestTimeLabel.Text = app.recallNote()
+	}
+	if standing := app.leaderboard.standing(app.currentPattern.Pattern); standing != "" {
+		app.bestTimeLabel.Text += " • " + standing
+	}
+	if app.adaptive != nil {
+		app.bestTimeLabel.Text += app.adaptive.note()
 	}
 	app.bestTimeLabel.Refresh()
 
-	app.targetDisplay.Text = formatForDisplay(app.currentPattern.Pattern)
-	app.targetDisplay.Color = color.RGBA{80, 220, 120, 255}
-	app.targetDisplay.Refresh()
+	app.targetDisplay.Color = app.palette.Target
+	app.showTarget()
 
 	app.inputDisplay.Text = "▌"
-	app.inputDisplay.Color = color.RGBA{150, 150, 150, 255}
+	app.inputDisplay.Color = app.palette.Muted
 	app.inputDisplay.Refresh()
 
 	app.statusLabel.Text = ""
 	app.statusLabel.Refresh()
 
 	app.progressLabel.Text = fmt.Sprintf("%d patterns remaining", len(app.patternQueue)+1)
+	app.progressLabel.Color = app.palette.Progress
 	app.progressLabel.Refresh()
 
-	app.updateClickZone()
+	if app.mode() == modeMetronome {
+		app.startMetronome()
+	}
+
+	if app.build != nil {
+		app.waitBuildStep()
+	} else {
+		app.updateClickZone()
+	}
 	app.window.Canvas().Focus(app.mainContainer)
 }
 
@@ -829,91 +1372,145 @@ func (app *App) addKey(key string) {
 	if !app.isActive {
 		return
 	}
+	if app.wrongInput {
+		app.fixMistake(key)
+		return
+	}
+
+	key, complete := app.collectDouble(key)
+	if !complete {
+		return
+	}
 
 	testInput := strings.Join(append(app.inputBuffer, key), "")
 	if !strings.HasPrefix(app.currentPattern.Pattern, testInput) {
-		position := len(testInput) - len(key)
-		expected := getExpectedKey(app.currentPattern.Pattern, position)
-
-		// Don't penalize first wrong input, but still show feedback
-		if len(app.inputBuffer) > 0 {
-			app.stats.recordMistake(app.currentPattern, position, expected, key)
-			app.stats.save()
-			app.resetCount++
-			app.inputBuffer = []string{}
-		}
-
-		app.statusLabel.Text = fmt.Sprintf("❌ Expected %s", formatForDisplay(expected))
-		app.statusLabel.Color = color.RGBA{255, 100, 100, 255}
-		app.statusLabel.Refresh()
+		expected := getExpectedKey(app.currentPattern.Pattern, len(testInput)-len(key))
+		app.rejectInput(expected, key, fmt.Sprintf("Expected %s", formatForDisplay(expected)))
+		return
+	}
 
-		app.inputDisplay.Text = "▌"
-		app.inputDisplay.Color = color.RGBA{255, 100, 100, 255}
-		app.inputDisplay.Refresh()
-		app.updateClickZone()
+	// In metronome mode every token must also land on its beat
+	if app.metronome != nil && !app.onBeat(key) {
 		return
 	}
 
 	// Start timer on first valid keystroke
 	if app.startTime.IsZero() {
-		app.startTime = time.Now()
+		app.startTime = app.now()
 	}
 
+	app.tokenSplits = append(app.tokenSplits[:len(app.inputBuffer)], app.now().Sub(app.startTime))
 	app.inputBuffer = append(app.inputBuffer, key)
+	app.lastOutcome = "ok"
+
+	// The flash ends once typing starts
+	if app.memory != nil {
+		app.memory.hidden = true
+	}
+
+	// Race the personal best from the first token
+	if len(app.inputBuffer) == 1 && app.ghostStop == nil && app.metronome == nil && app.build == nil && app.multitask == nil &&
+		(app.adaptive == nil || app.adaptive.rung().hideAfter == 0) && app.memory == nil {
+		app.startGhost()
+	}
+
 	app.updateInputDisplay()
 
 	// Check for completion
 	currentInput := strings.Join(app.inputBuffer, "")
 	if len(currentInput) >= len(app.currentPattern.Pattern) {
 		app.finishPattern()
+	} else {
+		app.audio.play(soundAccept)
 	}
 }
 
+// pressKey feeds a keyboard token, or a click away from the grid. In
+// multitask mode a token the main pattern isn't waiting for may belong to a
+// raised interrupt.
+func (app *App) pressKey(key string) {
+	app.lastOutcome = ""
+	if app.mainExpects(key) || !app.laneInput(key) {
+		app.addKey(key)
+	}
+	app.record(replayEvent{Kind: "key", Key: key, Cell: -1})
+}
+
+// gridClick judges a click on a grid cell
+func (app *App) gridClick(cell int, clickType string) {
+	app.lastOutcome = ""
+	if cell == app.activeCell && clickType == app.expectedSingleClick() {
+		app.addKey(clickType)
+	} else if !app.laneInput(clickType) {
+		// Wrong cell or wrong click type
+		app.handleWrongGridClick(clickType, cell)
+	}
+	app.record(replayEvent{Kind: "click", Key: clickType, Cell: cell})
+}
+
 func (app *App) handleWrongGridClick(clickType string, clickedCell int) {
-	position := len(strings.Join(app.inputBuffer, ""))
-	
 	var reason string
-	if clickType != app.expectedClick {
+	if clickType != app.expectedSingleClick() {
 		reason = fmt.Sprintf("wrong button (got %s)", formatForDisplay(clickType))
 	} else {
 		reason = "wrong cell"
 	}
+	app.registerGridMistake(clickType, reason)
+}
+
+// registerGridMistake handles any rejected grid input (click or drag)
+func (app *App) registerGridMistake(actual, reason string) {
+	app.rejectInput(app.expectedClick, actual+" "+reason, fmt.Sprintf("%s%s!", strings.ToUpper(reason[:1]), reason[1:]))
+}
+
+// rejectInput records a mistake and charges it as the mistake policy says
+func (app *App) rejectInput(expected, actual, message string) {
+	position := len(strings.Join(app.inputBuffer, ""))
+	app.pendingDouble = time.Time{}
+	app.lastOutcome = "miss"
 
 	// Don't penalize first wrong input, but still show feedback
-	if len(app.inputBuffer) > 0 {
-		app.stats.recordMistake(app.currentPattern, position, app.expectedClick, clickType+" "+reason)
+	if len(app.inputBuffer) > 0 && !app.wrongInput {
+		app.stats.recordMistake(app.currentPattern, position, expected, actual)
 		app.stats.save()
-		app.resetCount++
-		app.inputBuffer = []string{}
+		message += app.applyMistake()
 	}
 
-	app.statusLabel.Text = fmt.Sprintf("❌ %s%s!", strings.ToUpper(reason[:1]), reason[1:])
-	app.statusLabel.Color = color.RGBA{255, 100, 100, 255}
+	app.audio.play(soundMistake)
+
+	app.statusLabel.Text = "❌ " + message
+	app.statusLabel.Color = app.palette.Error
 	app.statusLabel.Refresh()
 
-	app.inputDisplay.Text = "▌"
-	app.inputDisplay.Color = color.RGBA{255, 100, 100, 255}
+	app.inputDisplay.Text = app.inputText()
+	app.inputDisplay.Color = app.palette.Error
 	app.inputDisplay.Refresh()
+	app.showTarget()
 	app.updateClickZone()
 }
 
 func (app *App) updateInputDisplay() {
-	input := strings.Join(app.inputBuffer, "")
-	if len(input) == 0 {
-		app.inputDisplay.Text = "▌"
-		app.inputDisplay.Color = color.RGBA{150, 150, 150, 255}
-	} else {
-		app.inputDisplay.Text = formatForDisplay(input)
-		app.inputDisplay.Color = color.RGBA{100, 255, 100, 255}
+	app.inputDisplay.Text = app.inputText()
+	switch {
+	case app.wrongInput:
+		app.inputDisplay.Color = app.palette.Error
+	case len(app.inputBuffer) == 0:
+		app.inputDisplay.Color = app.palette.Muted
+	default:
+		app.inputDisplay.Color = app.palette.Success
 	}
 	app.inputDisplay.Refresh()
+	app.showTarget()
 	app.updateClickZone()
 }
 
 func (app *App) updateClickZone() {
+	app.dragArmed = false
+	app.dragBox.Hide()
+
 	// Reset all cells to inactive
 	for i := 0; i < 16; i++ {
-		app.clickGrid[i].FillColor = color.RGBA{40, 40, 50, 255}
+		app.clickGrid[i].FillColor = app.palette.Cell
 		app.clickGridTexts[i].Text = ""
 		app.clickGrid[i].Refresh()
 		app.clickGridTexts[i].Refresh()
@@ -928,25 +1525,31 @@ func (app *App) updateClickZone() {
 	input := strings.Join(app.inputBuffer, "")
 	nextKey := getExpectedKey(app.currentPattern.Pattern, len(input))
 
-	var clickColor color.RGBA
+	var clickColor color.Color
 	var clickText string
 
 	switch nextKey {
 	case "LC":
-		clickColor = color.RGBA{60, 160, 60, 255}
+		clickColor = app.palette.LeftClick
 		clickText = "L"
 	case "RC":
-		clickColor = color.RGBA{60, 60, 200, 255}
+		clickColor = app.palette.RightClick
 		clickText = "R"
 	case "MC":
-		clickColor = color.RGBA{160, 60, 160, 255}
+		clickColor = app.palette.MiddleClick
 		clickText = "M"
 	case "SLC":
-		clickColor = color.RGBA{160, 160, 60, 255}
+		clickColor = app.palette.ShiftLeftClick
 		clickText = "⇧L"
 	case "SRC":
-		clickColor = color.RGBA{60, 160, 160, 255}
+		clickColor = app.palette.ShiftRightClick
 		clickText = "⇧R"
+	case "DLC":
+		clickColor = app.palette.DoubleLeftClick
+		clickText = "L×2"
+	case "DRAG":
+		app.showDragTarget()
+		return
 	default:
 		app.activeCell = -1
 		app.expectedClick = ""
@@ -954,7 +1557,7 @@ func (app *App) updateClickZone() {
 	}
 
 	// Pick a random cell
-	app.activeCell = rand.Intn(16)
+	app.activeCell = app.rng.Intn(16)
 	app.expectedClick = nextKey
 	app.clickGrid[app.activeCell].FillColor = clickColor
 	app.clickGridTexts[app.activeCell].Text = clickText
@@ -968,36 +1571,80 @@ func (app *App) finishPattern() {
 	}
 
 	app.isActive = false
-	elapsed := time.Since(app.startTime)
+	defer app.checkAchievements()
+	elapsed := app.now().Sub(app.startTime) + app.penalty
+	app.stopGhost()
+	app.lastOutcome = "done"
 
 	app.sessionTotal++
 
+	if app.metronome != nil {
+		app.finishRhythm()
+		app.scheduleNextPattern()
+		return
+	}
+	if app.build != nil {
+		app.finishBuildStep()
+		app.scheduleNextPattern()
+		return
+	}
+	if app.multitask != nil {
+		app.finishMainLane()
+		app.scheduleNextPattern()
+		return
+	}
+	if app.memory != nil {
+		app.finishRecall(elapsed)
+		app.scheduleNextPattern()
+		return
+	}
+
 	// Record stats
-	app.stats.recordAttempt(app.currentPattern, elapsed, app.resetCount)
-	app.stats.save()
+	prevSplits := app.pbSplits()
+	app.stats.recordAttempt(app.currentPattern, app.settings.profileName(), elapsed, app.resetCount, app.forgiven, app.mistakePolicy())
+	app.race.report(raceMsg{Type: "done", Perfect: app.perfectRun()})
+	app.addDailyTime(elapsed)
 
-	if app.resetCount == 0 {
+	if app.perfectRun() {
 		app.sessionPerfect++
+		app.showSplitComparison(prevSplits, app.tokenSplits)
 
 		// Check if new best
-		ps := app.stats.PatternStats[app.currentPattern.Pattern]
+		ps := app.stats.PatternStats[app.currentPattern.key()]
 		if elapsed == ps.BestTime {
+			ps.BestSplits = app.tokenSplits
+			app.leaderboard.submit(app.currentPattern, app.settings.profileName(), elapsed)
 			app.statusLabel.Text = fmt.Sprintf("✅ NEW BEST! %v", elapsed.Round(time.Millisecond))
-			app.statusLabel.Color = color.RGBA{255, 215, 0, 255}
+			app.statusLabel.Color = app.palette.Best
+			app.audio.play(soundNewBest)
 		} else {
 			app.statusLabel.Text = fmt.Sprintf("✅ %v", elapsed.Round(time.Millisecond))
-			app.statusLabel.Color = color.RGBA{100, 255, 100, 255}
+			app.statusLabel.Color = app.palette.Success
+			app.audio.play(soundComplete)
 		}
-		app.inputDisplay.Color = color.RGBA{0, 255, 0, 255}
+		app.inputDisplay.Color = app.palette.Done
 	} else {
-		app.patternQueue = append(app.patternQueue, app.currentPattern)
-		app.statusLabel.Text = fmt.Sprintf("↻ %d resets - retry later", app.resetCount)
-		app.statusLabel.Color = color.RGBA{255, 180, 100, 255}
-		app.inputDisplay.Color = color.RGBA{255, 200, 100, 255}
+		app.statusLabel.Text = app.spoiledNote() + " - " + app.requeue(app.currentPattern)
+		app.statusLabel.Color = app.palette.Warning
+		app.audio.play(soundComplete)
+		app.inputDisplay.Color = app.palette.Caution
 	}
+	if app.adaptive != nil {
+		app.statusLabel.Text += app.finishAdaptive(elapsed)
+	}
+	app.stats.save()
 	app.statusLabel.Refresh()
 	app.inputDisplay.Refresh()
 
+	app.scheduleNextPattern()
+}
+
+// scheduleNextPattern moves on after a short pause to read the result
+func (app *App) scheduleNextPattern() {
+	// A replay advances on its own recorded events
+	if app.playback {
+		return
+	}
 	go func() {
 		time.Sleep(400 * time.Millisecond)
 		fyne.Do(func() {
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"fyne.io/fyne/v2"
+)
+
+// RecallStats is a pattern's record in memory mode, kept apart from the
+// reading stats so the two can be compared
+type RecallStats struct {
+	Attempts     int           `json:"attempts"`
+	PerfectCount int           `json:"perfect_count"`
+	TotalResets  int           `json:"total_resets"`
+	BestTime     time.Duration `json:"best_time"`
+	TotalTime    time.Duration `json:"total_time"`
+}
+
+// memoryRun is the flash of the pattern being played in memory mode
+type memoryRun struct {
+	hidden bool
+}
+
+func (s *Settings) memoryFlash() time.Duration {
+	return time.Duration(s.MemoryFlashMs) * time.Millisecond
+}
+
+// startFlash shows the target for the flash time, then hides it. With no
+// flash time only the name is shown. The target also goes as soon as the
+// first key lands, so it can't be read while typing.
+func (app *App) startFlash() {
+	run := &memoryRun{hidden: app.settings.MemoryFlashMs <= 0}
+	app.memory = run
+	// A replay hides the target on the first key; its clock doesn't run
+	// at wall speed
+	if run.hidden || app.playback {
+		return
+	}
+	flash := app.settings.memoryFlash()
+	go func() {
+		time.Sleep(flash)
+		fyne.Do(func() {
+			if app.memory == run && app.isActive {
+				run.hidden = true
+				app.showTarget()
+			}
+		})
+	}()
+}
+
+func (s *AllStats) recallStats(p Pattern) *RecallStats {
+	if ps, ok := s.PatternStats[p.key()]; ok {
+		return ps.Recall
+	}
+	return nil
+}
+
+// recallNote puts the recall best beside the reading best
+func (app *App) recallNote() string {
+	text := "No recall record yet"
+	if r := app.stats.recallStats(app.currentPattern); r != nil && r.BestTime > 0 {
+		text = fmt.Sprintf("🧠 Recall best: %v", r.BestTime.Round(time.Millisecond))
+	}
+	if best := app.stats.bestTime(app.currentPattern); best > 0 {
+		text += fmt.Sprintf(" • Read best: %v", best.Round(time.Millisecond))
+	}
+	return text
+}
+
+func (s *AllStats) recordRecall(pattern Pattern, elapsed time.Duration, resets, forgiven int) {
+	ps := s.getPatternStats(pattern)
+	if ps.Recall == nil {
+		ps.Recall = &RecallStats{}
+	}
+	r := ps.Recall
+	r.Attempts++
+	r.TotalTime += elapsed
+	r.TotalResets += resets
+	ps.LastPracticed = time.Now()
+
+	if resets == 0 && forgiven == 0 {
+		r.PerfectCount++
+		if r.BestTime == 0 || elapsed < r.BestTime {
+			r.BestTime = elapsed
+		}
+	}
+}
+
+// finishRecall scores a completed memory mode run against the recall
+// record and the reading best
+func (app *App) finishRecall(elapsed time.Duration) {
+	app.stats.recordRecall(app.currentPattern, elapsed, app.resetCount, app.forgiven)
+	app.stats.save()
+
+	if app.perfectRun() {
+		app.sessionPerfect++
+		r := app.stats.recallStats(app.currentPattern)
+		if elapsed == r.BestTime {
+			app.statusLabel.Text = fmt.Sprintf("🧠 NEW RECALL BEST! %v", elapsed.Round(time.Millisecond))
+			app.statusLabel.Color = app.palette.Best
+			app.audio.play(soundNewBest)
+		} else {
+			app.statusLabel.Text = fmt.Sprintf("🧠 %v", elapsed.Round(time.Millisecond))
+			app.statusLabel.Color = app.palette.Success
+			app.audio.play(soundComplete)
+		}
+		if best := app.stats.bestTime(app.currentPattern); best > 0 {
+			app.statusLabel.Text += fmt.Sprintf(" • %+.2fs on reading", (elapsed - best).Seconds())
+		}
+		app.inputDisplay.Color = app.palette.Done
+	} else {
+		app.statusLabel.Text = app.spoiledNote() + " - " + app.requeue(app.currentPattern)
+		app.statusLabel.Color = app.palette.Warning
+		app.audio.play(soundComplete)
+		app.inputDisplay.Color = app.palette.Caution
+	}
+	app.statusLabel.Refresh()
+	app.inputDisplay.Refresh()
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"fyne.io/fyne/v2"
+)
+
+// maxMetronomeBPM caps how far clean runs can push the tempo
+const maxMetronomeBPM = 300
+
+// metronome keeps the beat for one pattern in metronome mode
+type metronome struct {
+	bpm        int
+	origin     time.Time // beat zero, when the pattern appeared
+	firstBeat  int       // beat the first token of the current run landed on
+	deviations []time.Duration
+	stop       chan struct{}
+}
+
+// metronomeTolerance is how far off the beat a token may land, falling back
+// to the default when the setting is missing or not positive
+func (s *Settings) metronomeTolerance() time.Duration {
+	if s.MetronomeToleranceMs <= 0 {
+		return 70 * time.Millisecond
+	}
+	return time.Duration(s.MetronomeToleranceMs) * time.Millisecond
+}
+
+// RhythmStats tracks metronome-mode runs of a pattern
+type RhythmStats struct {
+	BPM            int           `json:"bpm"`     // tempo for the next run
+	TopBPM         int           `json:"top_bpm"` // fastest tempo completed cleanly
+	Attempts       int           `json:"attempts"`
+	CleanRuns      int           `json:"clean_runs"`
+	BestDeviation  time.Duration `json:"best_deviation"`  // lowest mean |deviation| of a clean run
+	TotalDeviation time.Duration `json:"total_deviation"` // sum of each run's mean |deviation|
+}
+
+func (m *metronome) beat() time.Duration {
+	return time.Minute / time.Duration(m.bpm)
+}
+
+// deviation returns how far a token lands from its beat. The first token of
+// a run snaps to the nearest beat; each following token belongs on the next.
+func (m *metronome) deviation(now time.Time, token int) time.Duration {
+	beat := m.beat()
+	if token == 0 {
+		m.firstBeat = int((now.Sub(m.origin) + beat/2) / beat)
+	}
+	target := m.origin.Add(time.Duration(m.firstBeat+token) * beat)
+	return now.Sub(target)
+}
+
+// meanDeviation is the average absolute timing error of the run
+func (m *metronome) meanDeviation() time.Duration {
+	if len(m.deviations) == 0 {
+		return 0
+	}
+	var total time.Duration
+	for _, d := range m.deviations {
+		total += d.Abs()
+	}
+	return total / time.Duration(len(m.deviations))
+}
+
+// tick plays the click on every beat until stopped
+func (m *metronome) tick(audio *Audio) {
+	ticker := time.NewTicker(m.beat())
+	defer ticker.Stop()
+
+	fyne.Do(func() { audio.play(soundTick) })
+	for {
+		select {
+		case <-m.stop:
+			return
+		case <-ticker.C:
+			fyne.Do(func() { audio.play(soundTick) })
+		}
+	}
+}
+
+func (app *App) startMetronome() {
+	bpm := max(app.settings.MetronomeBPM, 1)
+	if ps, ok := app.stats.PatternStats[app.currentPattern.key()]; ok && ps.Rhythm != nil && ps.Rhythm.BPM > 0 {
+		bpm = ps.Rhythm.BPM
+	}
+
+	app.metronome = &metronome{
+		bpm:    bpm,
+		origin: app.now(),
+		stop:   make(chan struct{}),
+	}
+	go app.metronome.tick(app.audio)
+
+	app.bestTimeLabel.Text = fmt.Sprintf("♩ %d BPM • ±%dms", bpm, app.settings.metronomeTolerance().Milliseconds())
+	app.bestTimeLabel.Color = app.palette.Info
+	app.bestTimeLabel.Refresh()
+}
+
+func (app *App) stopMetronome() {
+	if app.metronome == nil {
+		return
+	}
+	close(app.metronome.stop)
+	app.metronome = nil
+}
+
+// onBeat checks the timing of a correct token, rejecting it if it falls
+// outside the tolerance window
+func (app *App) onBeat(key string) bool {
+	token := len(app.inputBuffer)
+	if token == 0 {
+		app.metronome.deviations = nil
+	}
+
+	dev := app.metronome.deviation(app.now(), token)
+	if dev.Abs() > app.settings.metronomeTolerance() {
+		direction := "Late"
+		if dev < 0 {
+			direction = "Early"
+		}
+		app.rejectInput(key, key+" off beat", fmt.Sprintf("%s by %v", direction, dev.Abs().Round(time.Millisecond)))
+		return false
+	}
+
+	app.metronome.deviations = append(app.metronome.deviations, dev)
+	return true
+}
+
+// finishRhythm scores a completed metronome run and adjusts its tempo
+func (app *App) finishRhythm() {
+	m := app.metronome
+	app.stopMetronome()
+
+	clean := app.perfectRun()
+	mean := m.meanDeviation()
+	next := app.stats.recordRhythm(app.currentPattern, m.bpm, mean, clean, app.settings.MetronomeStep)
+	app.stats.save()
+
+	if clean {
+		app.sessionPerfect++
+		app.statusLabel.Text = fmt.Sprintf("♩ ±%v @ %d BPM", mean.Round(time.Millisecond), m.bpm)
+		if next > m.bpm {
+			app.statusLabel.Text += fmt.Sprintf(" → %d", next)
+		}
+		app.statusLabel.Color = app.palette.Success
+		app.inputDisplay.Color = app.palette.Done
+		app.audio.play(soundComplete)
+	} else {
+		app.statusLabel.Text = app.spoiledNote() + " - " + app.requeue(app.currentPattern)
+		app.statusLabel.Color = app.palette.Warning
+		app.inputDisplay.Color = app.palette.Caution
+		app.audio.play(soundComplete)
+	}
+	app.statusLabel.Refresh()
+	app.inputDisplay.Refresh()
+}
+
+// recordRhythm stores a metronome run and returns the tempo for the next one
+func (s *AllStats) recordRhythm(pattern Pattern, bpm int, mean time.Duration, clean bool, step int) int {
+	ps := s.getPatternStats(pattern)
+	if ps.Rhythm == nil {
+		ps.Rhythm = &RhythmStats{}
+	}
+	r := ps.Rhythm
+	r.Attempts++
+	r.TotalDeviation += mean
+	r.BPM = bpm
+	ps.LastPracticed = time.Now()
+
+	if clean {
+		r.CleanRuns++
+		if r.BestDeviation == 0 || mean < r.BestDeviation {
+			r.BestDeviation = mean
+		}
+		if bpm > r.TopBPM {
+			r.TopBPM = bpm
+		}
+		r.BPM = min(bpm+step, maxMetronomeBPM)
+	}
+	return r.BPM
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// MistakePolicy decides what a wrong input costs
+type MistakePolicy string
+
+const (
+	policyReset      MistakePolicy = "reset"      // start the pattern over
+	policyCheckpoint MistakePolicy = "checkpoint" // back to the start of the current group
+	policyPenalty    MistakePolicy = "penalty"    // carry on with time added
+	policyBackspace  MistakePolicy = "backspace"  // carry on once the mistake is erased with BKSP
+)
+
+var mistakePolicies = []MistakePolicy{policyReset, policyCheckpoint, policyPenalty, policyBackspace}
+
+func (app *App) mistakePolicy() MistakePolicy {
+	// Everyone in a race or on the daily challenge plays by the strict rules
+	if app.race != nil || app.daily != nil {
+		return policyReset
+	}
+	for _, p := range mistakePolicies {
+		if p == app.settings.MistakePolicy {
+			return p
+		}
+	}
+	return policyReset
+}
+
+func (s *Settings) penalty() time.Duration {
+	if s.PenaltyMs <= 0 {
+		return time.Second
+	}
+	return time.Duration(s.PenaltyMs) * time.Millisecond
+}
+
+// applyMistake charges a mistake on a pattern already under way, and
+// returns a note on what it cost. The forgiving policies count the mistake
+// as forgiven rather than a reset; either spoils a perfect run.
+func (app *App) applyMistake() string {
+	switch app.mistakePolicy() {
+	case policyCheckpoint:
+		app.resetCount++
+		keep := groupStart(splitTokens(app.currentPattern.Pattern), len(app.inputBuffer))
+		app.inputBuffer = app.inputBuffer[:keep]
+		if keep == 0 {
+			return ""
+		}
+		return " • back to the group start"
+	case policyPenalty:
+		app.forgiven++
+		app.penalty += app.settings.penalty()
+		return fmt.Sprintf(" • +%.1fs", app.settings.penalty().Seconds())
+	case policyBackspace:
+		app.forgiven++
+		app.wrongInput = true
+		return " • ⌫ to fix"
+	}
+	app.resetCount++
+	app.inputBuffer = []string{}
+	return ""
+}
+
+// perfectRun reports whether the pattern was finished without a mistake.
+// A forgiving policy saves starting over, but the run isn't perfect.
+func (app *App) perfectRun() bool {
+	return app.resetCount == 0 && app.forgiven == 0
+}
+
+// spoiledNote says what kept a run from being perfect
+func (app *App) spoiledNote() string {
+	if app.resetCount == 0 {
+		return fmt.Sprintf("✗ %d forgiven", app.forgiven)
+	}
+	return fmt.Sprintf("↻ %d resets", app.resetCount)
+}
+
+// groupStart returns where the group holding token done begins. A group
+// starts at a control group key or an F-key, so "1a2a" has groups at 0 and
+// 2; a mistake on the 2 keeps "1a".
+func groupStart(tokens []string, done int) int {
+	for i := min(done, len(tokens)-1); i > 0; i-- {
+		if startsGroup(tokens[i]) {
+			return i
+		}
+	}
+	return 0
+}
+
+func startsGroup(token string) bool {
+	if single, ok := doubleTokens[token]; ok && single != "LC" {
+		return true
+	}
+	if len(token) == 1 && token >= "0" && token <= "9" {
+		return true
+	}
+	return len(token) >= 2 && token[0] == 'F' && strings.Trim(token[1:], "0123456789") == ""
+}
+
+// fixMistake erases a pending mistake under the backspace policy. Any other
+// input is ignored until it's gone.
+func (app *App) fixMistake(key string) {
+	if key != "BKSP" {
+		return
+	}
+	app.wrongInput = false
+	app.lastOutcome = "ok"
+	app.statusLabel.Text = "⌫ Fixed - carry on"
+	app.statusLabel.Color = app.palette.Caution
+	app.statusLabel.Refresh()
+	app.updateInputDisplay()
+}
+
+// inputText shows the input so far, marking a mistake waiting to be erased
+func (app *App) inputText() string {
+	text := "▌"
+	if input := strings.Join(app.inputBuffer, ""); input != "" {
+		text = formatForDisplay(input)
+	}
+	if app.wrongInput {
+		text += " ✗"
+	}
+	return text
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+)
+
+// Mode selects how a session is played
+type Mode string
+
+const (
+	modeNormal    Mode = "normal"
+	modeMetronome Mode = "metronome"
+	modeBuild     Mode = "build"
+	modeMultitask Mode = "multitask"
+	modeAdaptive  Mode = "adaptive"
+	modeMemory    Mode = "memory"
+)
+
+// modes is the order the idle screen cycles through
+var modes = []Mode{modeNormal, modeMetronome, modeBuild, modeMultitask, modeAdaptive, modeMemory}
+
+var modeLabels = map[Mode]string{
+	modeNormal:    "Speed",
+	modeMetronome: "♩ Metronome",
+	modeBuild:     "⚒ Build Order",
+	modeMultitask: "⚡ Multitask",
+	modeAdaptive:  "📈 Adaptive",
+	modeMemory:    "🧠 Memory",
+}
+
+func (app *App) mode() Mode {
+	// Everyone in a race or on the daily challenge plays the same speed
+	// session
+	if app.race != nil || app.daily != nil {
+		return modeNormal
+	}
+	if _, ok := modeLabels[app.settings.Mode]; ok {
+		return app.settings.Mode
+	}
+	return modeNormal
+}
+
+// cycleMode switches to the next mode and remembers it
+func (app *App) cycleMode() {
+	current := app.mode()
+	next := modes[0]
+	for i, m := range modes {
+		if m == current {
+			next = modes[(i+1)%len(modes)]
+		}
+	}
+	app.settings.Mode = next
+	app.settings.save()
+
+	app.statusLabel.Text = fmt.Sprintf("Mode: %s", modeLabels[next])
+	app.statusLabel.Color = app.palette.Info
+	app.statusLabel.Refresh()
+}
+
+// handleIdleRune handles typed characters outside a session
+func (app *App) handleIdleRune(r rune) {
+	switch r {
+	case 'm', 'M':
+		app.cycleMode()
+	case 'r', 'R':
+		app.openLatestReplay()
+	case 'g', 'G':
+		app.cycleSource()
+	case 'd', 'D':
+		app.startDaily()
+	case 'b', 'B':
+		app.cycleBuildOrder()
+	case 'e', 'E':
+		app.openEditor()
+	case 'x', 'X':
+		app.exportFromIdle()
+	case 'a', 'A':
+		app.openAchievements()
+	}
+}
@@ -0,0 +1,345 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+)
+
+// laneFrame is how often interrupt lanes are checked and their countdown
+// redrawn
+const laneFrame = 100 * time.Millisecond
+
+// Interrupt is a short pattern raised on a timer in multitask mode, like a
+// rally or a scout check in the middle of a fight
+type Interrupt struct {
+	Name       string `json:"name"`
+	Pattern    string `json:"pattern"`
+	EveryMs    int    `json:"every_ms"`    // average gap between raises
+	DeadlineMs int    `json:"deadline_ms"` // time allowed once raised
+}
+
+var defaultInterrupts = []Interrupt{
+	{Name: "Rally", Pattern: "F2RC", EveryMs: 8000, DeadlineMs: 3000},
+	{Name: "Scout", Pattern: "F3LC", EveryMs: 13000, DeadlineMs: 3000},
+}
+
+func (i Interrupt) every() time.Duration {
+	if i.EveryMs <= 0 {
+		return 8 * time.Second
+	}
+	return time.Duration(i.EveryMs) * time.Millisecond
+}
+
+func (i Interrupt) deadline() time.Duration {
+	if i.DeadlineMs <= 0 {
+		return 3 * time.Second
+	}
+	return time.Duration(i.DeadlineMs) * time.Millisecond
+}
+
+// lane is one interrupt's state during a session
+type lane struct {
+	interrupt Interrupt
+	tokens    []string
+	nextAt    time.Time // when it is raised next
+	raisedAt  time.Time // zero while waiting
+	progress  int       // tokens entered since it was raised
+	half      time.Time // first press of a double token, zero if none
+}
+
+// multitask runs the interrupt lanes beside the main pattern
+type multitask struct {
+	lanes    []*lane
+	hit      int
+	missed   int
+	reaction time.Duration // total time to complete the hit interrupts
+	stop     chan struct{}
+}
+
+// MultitaskStats tracks multitask sessions across both lanes
+type MultitaskStats struct {
+	Sessions     int                        `json:"sessions"`
+	MainPatterns int                        `json:"main_patterns"`
+	MainPerfect  int                        `json:"main_perfect"`
+	Interrupts   map[string]*InterruptStats `json:"interrupts"`
+}
+
+// InterruptStats tracks one interrupt lane
+type InterruptStats struct {
+	Raised        int           `json:"raised"`
+	Hit           int           `json:"hit"`
+	Missed        int           `json:"missed"`
+	TotalReaction time.Duration `json:"total_reaction"`
+	BestReaction  time.Duration `json:"best_reaction"`
+}
+
+// scheduleLane picks the next raise time, jittered by up to a quarter of the
+// interval so interrupts can't be anticipated
+func (app *App) scheduleLane(l *lane) {
+	every := l.interrupt.every()
+	jitter := time.Duration(app.rng.Int63n(int64(every/2)+1)) - every/4
+	l.nextAt = app.now().Add(every + jitter)
+	l.raisedAt = time.Time{}
+	l.progress = 0
+	l.half = time.Time{}
+}
+
+func (app *App) beginMultitask() {
+	interrupts := app.settings.Interrupts
+	if len(interrupts) == 0 {
+		interrupts = defaultInterrupts
+	}
+
+	app.multitask = &multitask{stop: make(chan struct{})}
+	for _, in := range interrupts {
+		if in.Pattern == "" {
+			continue
+		}
+		l := &lane{interrupt: in, tokens: splitTokens(in.Pattern)}
+		app.scheduleLane(l)
+		app.multitask.lanes = append(app.multitask.lanes, l)
+	}
+
+	go func(stop chan struct{}) {
+		ticker := time.NewTicker(laneFrame)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				fyne.Do(app.tickLanes)
+			}
+		}
+	}(app.multitask.stop)
+}
+
+// tickLanes raises interrupts that are due and expires those past their
+// deadline. A replay does both on its recorded events instead.
+func (app *App) tickLanes() {
+	if app.multitask == nil {
+		return
+	}
+	if !app.playback && app.inSession {
+		now := app.now()
+		for i, l := range app.multitask.lanes {
+			switch {
+			case l.raisedAt.IsZero() && !now.Before(l.nextAt):
+				app.raiseLane(i)
+			case !l.raisedAt.IsZero() && now.Sub(l.raisedAt) > l.interrupt.deadline():
+				app.expireLane(i)
+			}
+		}
+	}
+	app.updateLaneDisplay()
+}
+
+func (app *App) raiseLane(i int) {
+	if app.multitask == nil || i >= len(app.multitask.lanes) {
+		return
+	}
+	l := app.multitask.lanes[i]
+	l.raisedAt = app.now()
+	l.progress = 0
+	l.half = time.Time{}
+	app.stats.multitaskStats().interrupt(l.interrupt.Name).Raised++
+
+	app.audio.play(soundTick)
+	app.lastOutcome = ""
+	app.record(replayEvent{Kind: "raise", Cell: -1, Lane: i})
+	app.updateLaneDisplay()
+}
+
+func (app *App) expireLane(i int) {
+	if app.multitask == nil || i >= len(app.multitask.lanes) {
+		return
+	}
+	l := app.multitask.lanes[i]
+	app.multitask.missed++
+	app.stats.multitaskStats().interrupt(l.interrupt.Name).Missed++
+	app.scheduleLane(l)
+
+	app.audio.play(soundMistake)
+	app.statusLabel.Text = fmt.Sprintf("⚡ Missed %s", l.interrupt.Name)
+	app.statusLabel.Color = app.palette.Error
+	app.statusLabel.Refresh()
+
+	app.lastOutcome = "miss"
+	app.record(replayEvent{Kind: "expire", Cell: -1, Lane: i})
+	app.updateLaneDisplay()
+}
+
+// mainExpects reports whether a keyboard token belongs to the main pattern.
+// Clicks for the main pattern only count on its grid cell.
+func (app *App) mainExpects(key string) bool {
+	if app.expectedClick != "" {
+		return false
+	}
+	expected := getExpectedKey(app.currentPattern.Pattern, len(strings.Join(app.inputBuffer, "")))
+	return key == expected || doubleTokens[expected] == key
+}
+
+// takingInput reports whether keys and clicks are wanted: by the main
+// pattern, or by interrupts that stay raised between patterns
+func (app *App) takingInput() bool {
+	return app.isActive || app.multitask != nil
+}
+
+// activeLane returns the raised lane waiting for this token, or for it as
+// half of a double token, preferring one already in progress
+func (app *App) activeLane(key string) *lane {
+	if app.multitask == nil {
+		return nil
+	}
+	var found *lane
+	for _, l := range app.multitask.lanes {
+		if l.raisedAt.IsZero() {
+			continue
+		}
+		if token := l.tokens[l.progress]; token != key && doubleTokens[token] != key {
+			continue
+		}
+		if found == nil || l.progress > found.progress {
+			found = l
+		}
+	}
+	return found
+}
+
+// laneExpects reports whether some raised interrupt wants this token next
+func (app *App) laneExpects(key string) bool {
+	return app.activeLane(key) != nil
+}
+
+// laneInput feeds a token to a raised interrupt, leaving the main pattern
+// untouched. It reports false if no interrupt wants it.
+func (app *App) laneInput(key string) bool {
+	l := app.activeLane(key)
+	if l == nil {
+		return false
+	}
+
+	// A double token needs a second press within the double interval; one
+	// that comes too late starts the pair over
+	if l.tokens[l.progress] != key {
+		now := app.now()
+		if l.half.IsZero() || now.Sub(l.half) > app.settings.doubleInterval() {
+			l.half = now
+			app.lastOutcome = "half"
+			return true
+		}
+	}
+	l.half = time.Time{}
+	l.progress++
+	app.lastOutcome = "ok"
+
+	if l.progress < len(l.tokens) {
+		app.audio.play(soundAccept)
+		app.updateLaneDisplay()
+		return true
+	}
+
+	reaction := app.now().Sub(l.raisedAt)
+	app.multitask.hit++
+	app.multitask.reaction += reaction
+	is := app.stats.multitaskStats().interrupt(l.interrupt.Name)
+	is.Hit++
+	is.TotalReaction += reaction
+	if is.BestReaction == 0 || reaction < is.BestReaction {
+		is.BestReaction = reaction
+	}
+	app.scheduleLane(l)
+
+	app.audio.play(soundComplete)
+	app.statusLabel.Text = fmt.Sprintf("⚡ %s in %.1fs", l.interrupt.Name, reaction.Seconds())
+	app.statusLabel.Color = app.palette.Lane
+	app.statusLabel.Refresh()
+	app.updateLaneDisplay()
+	return true
+}
+
+// updateLaneDisplay lists raised interrupts with their remaining tokens and
+// time left
+func (app *App) updateLaneDisplay() {
+	var parts []string
+	if app.multitask != nil {
+		now := app.now()
+		for _, l := range app.multitask.lanes {
+			if l.raisedAt.IsZero() {
+				continue
+			}
+			left := max(l.interrupt.deadline()-now.Sub(l.raisedAt), 0)
+			remaining := strings.Join(l.tokens[l.progress:], "")
+			parts = append(parts, fmt.Sprintf("⚡ %s %s %.1fs", l.interrupt.Name, formatForDisplay(remaining), left.Seconds()))
+		}
+	}
+	app.laneDisplay.Text = strings.Join(parts, "    ")
+	app.laneDisplay.Refresh()
+}
+
+// finishMainLane scores a main pattern finished in multitask mode. Times are
+// not compared with speed-mode records since interrupts slow them down.
+func (app *App) finishMainLane() {
+	ms := app.stats.multitaskStats()
+	ms.MainPatterns++
+
+	if app.perfectRun() {
+		app.sessionPerfect++
+		ms.MainPerfect++
+		app.statusLabel.Text = "✅ Main pattern clean"
+		app.statusLabel.Color = app.palette.Success
+		app.inputDisplay.Color = app.palette.Done
+	} else {
+		app.statusLabel.Text = app.spoiledNote() + " - " + app.requeue(app.currentPattern)
+		app.statusLabel.Color = app.palette.Warning
+		app.inputDisplay.Color = app.palette.Caution
+	}
+	app.audio.play(soundComplete)
+	app.stats.save()
+	app.statusLabel.Refresh()
+	app.inputDisplay.Refresh()
+}
+
+// finishMultitask stops the lanes and shows both lanes' scores
+func (app *App) finishMultitask() {
+	mt := app.multitask
+	if mt == nil {
+		return
+	}
+	close(mt.stop)
+	app.multitask = nil
+	app.updateLaneDisplay()
+
+	app.stats.multitaskStats().Sessions++
+	app.stats.save()
+
+	text := fmt.Sprintf("Main %d/%d clean • Interrupts %d/%d hit", app.sessionPerfect, app.sessionTotal, mt.hit, mt.hit+mt.missed)
+	if mt.hit > 0 {
+		text += fmt.Sprintf(" • avg %.1fs", (mt.reaction / time.Duration(mt.hit)).Seconds())
+	}
+	app.progressLabel.Text = text
+	app.progressLabel.Color = app.palette.Progress
+	app.progressLabel.Refresh()
+}
+
+func (s *AllStats) multitaskStats() *MultitaskStats {
+	if s.Multitask == nil {
+		s.Multitask = &MultitaskStats{}
+	}
+	if s.Multitask.Interrupts == nil {
+		s.Multitask.Interrupts = make(map[string]*InterruptStats)
+	}
+	return s.Multitask
+}
+
+func (ms *MultitaskStats) interrupt(name string) *InterruptStats {
+	is, ok := ms.Interrupts[name]
+	if !ok {
+		is = &InterruptStats{}
+		ms.Interrupts[name] = is
+	}
+	return is
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// statsVersion 1 keys PatternStats by pattern ID instead of the raw pattern
+const statsVersion = 1
+
+// Pack is a shareable set of patterns with a little metadata, kept as a
+// single JSON file
+type Pack struct {
+	Name        string    `json:"name"`
+	Author      string    `json:"author,omitempty"`
+	Race        string    `json:"race,omitempty"` // Terran, Zerg, Protoss or Any
+	Version     string    `json:"version,omitempty"`
+	Description string    `json:"description,omitempty"`
+	Patterns    []Pattern `json:"patterns"`
+}
+
+// patternHash identifies a pattern by its content. It is the ID a pattern
+// gets when first seen, and how the leaderboard matches patterns across
+// teammates whose names differ.
+func patternHash(pattern string) string {
+	sum := sha256.Sum256([]byte(pattern))
+	return hex.EncodeToString(sum[:8])
+}
+
+// key is the pattern's stable ID, falling back to its content hash for
+// patterns that never had one, like build order steps
+func (p Pattern) key() string {
+	if p.ID != "" {
+		return p.ID
+	}
+	return patternHash(p.Pattern)
+}
+
+func loadPack(path string) (*Pack, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var pack Pack
+	if err := json.Unmarshal(data, &pack); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for i, p := range pack.Patterns {
+		if p.Pattern == "" {
+			return nil, fmt.Errorf("%s: pattern %d is empty", path, i+1)
+		}
+		if p.Name == "" {
+			pack.Patterns[i].Name = p.Pattern
+		}
+		if p.ID == "" {
+			pack.Patterns[i].ID = patternHash(p.Pattern)
+		}
+	}
+	return &pack, nil
+}
+
+func (p *Pack) save(path string) error {
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// exportPack writes the loaded patterns as a pack, named after the file
+// unless the pack already has a name
+func exportPack(w io.Writer, path string, pack Pack) error {
+	if pack.Name == "" {
+		pack.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	pack.Patterns = nil
+	for _, p := range loadPatterns() {
+		p.ID = p.key()
+		pack.Patterns = append(pack.Patterns, p)
+	}
+	if err := pack.save(path); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "Exported %d patterns to %s\n", len(pack.Patterns), path)
+	return nil
+}
+
+// importPack appends a pack's patterns to the patterns file, skipping any
+// whose ID is already there. Without a patterns file in the working
+// directory, the patterns currently in use are written first so importing
+// doesn't drop them.
+func importPack(w io.Writer, path string) error {
+	pack, err := loadPack(path)
+	if err != nil {
+		return err
+	}
+
+	// The file is being written anyway, so its IDs are settled first
+	current, currentPath := locatePatterns()
+	if err := pinPatternIDs(currentPath); err != nil {
+		return err
+	}
+	var lines []string
+	if _, err := os.Stat(patternsFile); os.IsNotExist(err) {
+		for _, p := range current {
+			lines = append(lines, patternLine(p))
+		}
+	}
+
+	have := make(map[string]bool)
+	for _, p := range current {
+		have[p.key()] = true
+	}
+	added := 0
+	for _, p := range pack.Patterns {
+		if have[p.ID] {
+			continue
+		}
+		if added == 0 {
+			lines = append(lines, "", "# "+packTitle(pack))
+		}
+		lines = append(lines, patternLine(p))
+		have[p.ID] = true
+		added++
+	}
+	if len(lines) > 0 {
+		file, err := os.OpenFile(patternsFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(file, strings.Join(lines, "\n"))
+		if cerr := file.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintf(w, "Imported %d of %d patterns from %s\n", added, len(pack.Patterns), packTitle(pack))
+	return nil
+}
+
+// packTitle describes a pack in one line, like "Zerg Basics v2 by Jaedong"
+func packTitle(p *Pack) string {
+	title := p.Name
+	if p.Version != "" {
+		title += " v" + strings.TrimPrefix(p.Version, "v")
+	}
+	if p.Author != "" {
+		title += " by " + p.Author
+	}
+	return title
+}
+
+// patternLine formats a pattern for the patterns file, keeping its ID so
+// later edits to the name or keys don't orphan its stats
+func patternLine(p Pattern) string {
+	return p.Name + "|" + p.Pattern + "|" + p.key()
+}
+
+// pinPatternIDs rewrites the lines of a patterns file that have no ID with
+// the one they were loaded with, their content hash. Until then, fixing a
+// typo in the keys would give the pattern a new ID and orphan its stats.
+func pinPatternIDs(path string) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	lines := strings.Split(string(data), "\n")
+	pinned := 0
+	for i, raw := range lines {
+		line := strings.TrimSpace(raw)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if parts := strings.SplitN(line, "|", 3); len(parts) == 3 && strings.TrimSpace(parts[2]) != "" {
+			continue
+		}
+		lines[i] = patternLine(parsePatternLine(line))
+		pinned++
+	}
+	if pinned == 0 {
+		return nil
+	}
+	return os.WriteFile(path, []byte(strings.Join(lines, "\n")), 0644)
+}
+
+// migrate rekeys stats saved before pattern IDs existed, which were keyed by
+// the raw pattern string
+func (s *AllStats) migrate(patterns []Pattern) {
+	if s.Version >= statsVersion {
+		return
+	}
+	ids := make(map[string]string)
+	for _, p := range patterns {
+		ids[p.Pattern] = p.key()
+	}
+
+	old := s.PatternStats
+	s.PatternStats = make(map[string]*PatternStats, len(old))
+	for raw, ps := range old {
+		if ps.Pattern == "" {
+			ps.Pattern = raw
+		}
+		id, ok := ids[ps.Pattern]
+		if !ok {
+			id = patternHash(ps.Pattern)
+		}
+		s.PatternStats[id] = ps
+	}
+	s.Version = statsVersion
+	s.save()
+}
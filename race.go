@@ -0,0 +1,383 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"image/color"
+	"net"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+)
+
+// LAN race: one instance hosts, the others join over TCP. Messages are JSON
+// lines. The host sends everyone the same seed and pattern list, so every
+// player gets the same queue and click cells; each player reports finished
+// patterns and the host broadcasts the leaderboard.
+
+// raceMsg is one message in either direction
+type raceMsg struct {
+	Type     string      `json:"type"` // hello, welcome, start, done, finish, quit, board
+	Name     string      `json:"name,omitempty"`
+	Round    int         `json:"round,omitempty"` // which race a start or report belongs to
+	Seed     int64       `json:"seed,omitempty"`
+	Patterns []Pattern   `json:"patterns,omitempty"`
+	Perfect  bool        `json:"perfect,omitempty"`
+	Ms       int64       `json:"ms,omitempty"` // session time of the event
+	Board    []raceEntry `json:"board,omitempty"`
+}
+
+// raceEntry is one player's line on the leaderboard
+type raceEntry struct {
+	Name     string `json:"name"`
+	Done     int    `json:"done"` // patterns completed perfectly
+	Total    int    `json:"total"`
+	Finished bool   `json:"finished"`
+	Quit     bool   `json:"quit"`
+	Ms       int64  `json:"ms"` // session time of their last event
+}
+
+const (
+	raceSendQueue    = 64              // messages waiting for a peer before it's dropped
+	raceWriteTimeout = 5 * time.Second // longest a peer may take to accept one
+)
+
+// racePeer is one end of a connection. Messages go out from a goroutine of
+// its own, so a stalled peer never holds up the caller, which is usually
+// the UI.
+type racePeer struct {
+	conn net.Conn
+	out  chan raceMsg
+	done chan struct{}
+	once sync.Once
+	name string
+}
+
+func newRacePeer(conn net.Conn) *racePeer {
+	p := &racePeer{conn: conn, out: make(chan raceMsg, raceSendQueue), done: make(chan struct{})}
+	go p.write()
+	return p
+}
+
+// send queues a message. A peer that has fallen a whole queue behind is
+// dropped; its reader then sees the connection close.
+func (p *racePeer) send(m raceMsg) {
+	select {
+	case p.out <- m:
+	case <-p.done:
+	default:
+		p.close()
+	}
+}
+
+func (p *racePeer) write() {
+	enc := json.NewEncoder(p.conn)
+	for {
+		select {
+		case m := <-p.out:
+			p.conn.SetWriteDeadline(time.Now().Add(raceWriteTimeout))
+			if err := enc.Encode(m); err != nil {
+				p.close()
+				return
+			}
+		case <-p.done:
+			return
+		}
+	}
+}
+
+func (p *racePeer) close() {
+	p.once.Do(func() {
+		close(p.done)
+		p.conn.Close()
+	})
+}
+
+// race is this instance's part in a race, as host or client
+type race struct {
+	app  *App
+	name string
+	host bool
+	addr string
+
+	round int // current race; reports from an earlier one are ignored
+
+	mu    sync.Mutex
+	peers []*racePeer           // host: joined players
+	board map[string]*raceEntry // host: everyone's progress, including the host
+	total int                   // host: patterns in the current race
+	link  *racePeer             // client: connection to the host
+
+	patterns []Pattern // client: the host's patterns for the current race
+}
+
+func hostRace(app *App, addr, name string) (*race, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	r := &race{
+		app:   app,
+		name:  name,
+		host:  true,
+		addr:  ln.Addr().String(),
+		board: map[string]*raceEntry{name: {Name: name}},
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go r.serve(newRacePeer(conn))
+		}
+	}()
+	return r, nil
+}
+
+func joinRace(app *App, addr, name string) (*race, error) {
+	conn, err := net.DialTimeout("tcp", addr, 5*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	r := &race{app: app, name: name, addr: addr, link: newRacePeer(conn)}
+	r.link.send(raceMsg{Type: "hello", Name: name})
+	go r.listen()
+	return r, nil
+}
+
+// serve reads one joined player's messages on the host
+func (r *race) serve(p *racePeer) {
+	defer p.close()
+	dec := json.NewDecoder(p.conn)
+	for {
+		var m raceMsg
+		if err := dec.Decode(&m); err != nil {
+			break
+		}
+		if m.Type == "hello" {
+			r.mu.Lock()
+			p.name = r.uniqueName(m.Name)
+			r.board[p.name] = &raceEntry{Name: p.name, Total: r.total}
+			r.peers = append(r.peers, p)
+			r.mu.Unlock()
+			p.send(raceMsg{Type: "welcome", Name: p.name})
+			r.broadcastBoard()
+			continue
+		}
+		if p.name != "" {
+			r.update(p.name, m)
+		}
+	}
+
+	r.mu.Lock()
+	for i, peer := range r.peers {
+		if peer == p {
+			r.peers = append(r.peers[:i], r.peers[i+1:]...)
+			break
+		}
+	}
+	if e, ok := r.board[p.name]; ok {
+		e.Quit = !e.Finished
+	}
+	r.mu.Unlock()
+	r.broadcastBoard()
+}
+
+// uniqueName keeps names on the board distinct; callers hold r.mu
+func (r *race) uniqueName(name string) string {
+	if name == "" {
+		name = "player"
+	}
+	unique := name
+	for i := 2; r.board[unique] != nil; i++ {
+		unique = fmt.Sprintf("%s (%d)", name, i)
+	}
+	return unique
+}
+
+// listen reads the host's messages on a client
+func (r *race) listen() {
+	dec := json.NewDecoder(r.link.conn)
+	for {
+		var m raceMsg
+		if err := dec.Decode(&m); err != nil {
+			r.link.close()
+			fyne.Do(func() { r.app.raceStatus("Lost connection to the host", r.app.palette.Error) })
+			return
+		}
+		switch m.Type {
+		case "welcome":
+			// The host may have renamed us to keep names distinct
+			fyne.Do(func() { r.name = m.Name })
+		case "start":
+			fyne.Do(func() { r.app.startRaceSession(m) })
+		case "board":
+			fyne.Do(func() { r.app.showBoard(m.Board) })
+		}
+	}
+}
+
+// update applies a player's progress on the host
+func (r *race) update(name string, m raceMsg) {
+	r.mu.Lock()
+	e, ok := r.board[name]
+	if ok && m.Round == r.round {
+		switch m.Type {
+		case "done":
+			if m.Perfect {
+				e.Done++
+			}
+		case "finish":
+			e.Finished = true
+		case "quit":
+			e.Quit = true
+		}
+		e.Ms = m.Ms
+	}
+	r.mu.Unlock()
+	r.broadcastBoard()
+}
+
+// ranked orders the board: finishers by time, then by patterns done
+func (r *race) ranked() []raceEntry {
+	var entries []raceEntry
+	for _, e := range r.board {
+		entries = append(entries, *e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.Finished != b.Finished {
+			return a.Finished
+		}
+		if a.Done != b.Done {
+			return a.Done > b.Done
+		}
+		if a.Ms != b.Ms {
+			return a.Ms < b.Ms
+		}
+		return a.Name < b.Name
+	})
+	return entries
+}
+
+func (r *race) broadcastBoard() {
+	r.mu.Lock()
+	board := r.ranked()
+	peers := append([]*racePeer(nil), r.peers...)
+	r.mu.Unlock()
+
+	for _, p := range peers {
+		p.send(raceMsg{Type: "board", Board: board})
+	}
+	fyne.Do(func() { r.app.showBoard(board) })
+}
+
+// begin starts a race for everyone on the host
+func (r *race) begin(seed int64, patterns []Pattern) {
+	if r == nil || !r.host {
+		return
+	}
+	r.mu.Lock()
+	r.round++
+	r.total = len(patterns)
+	for _, e := range r.board {
+		*e = raceEntry{Name: e.Name, Total: r.total}
+	}
+	peers := append([]*racePeer(nil), r.peers...)
+	r.mu.Unlock()
+
+	for _, p := range peers {
+		p.send(raceMsg{Type: "start", Round: r.round, Seed: seed, Patterns: patterns})
+	}
+	r.broadcastBoard()
+}
+
+// report sends this player's progress
+func (r *race) report(m raceMsg) {
+	if r == nil {
+		return
+	}
+	m.Round = r.round
+	m.Ms = time.Since(r.app.sessionStart).Milliseconds()
+	if r.host {
+		r.update(r.name, m)
+	} else {
+		r.link.send(m)
+	}
+}
+
+// raceName is the name shown on the board when -name isn't given: the
+// player name from the settings, or the login name
+func raceName(s *Settings) string {
+	if name := s.playerName(); name != "" {
+		return name
+	}
+	for _, env := range []string{"USER", "USERNAME"} {
+		if name := os.Getenv(env); name != "" {
+			return name
+		}
+	}
+	return "player"
+}
+
+// sessionPatterns is the patterns the session plays: the host's in a race
+// we joined, otherwise the player's own
+func (app *App) sessionPatterns() []Pattern {
+	if app.race != nil && !app.race.host {
+		return app.race.patterns
+	}
+	return app.allPatterns
+}
+
+// startRaceSession starts the race the host announced, abandoning any
+// earlier one still running
+func (app *App) startRaceSession(start raceMsg) {
+	if app.inSession {
+		app.stopSession()
+	}
+	app.race.round = start.Round
+	app.race.patterns = start.Patterns
+	app.launchSession(start.Seed)
+}
+
+func (app *App) raceStatus(text string, c color.Color) {
+	app.statusLabel.Text = text
+	app.statusLabel.Color = c
+	app.statusLabel.Refresh()
+}
+
+// showBoard redraws the leaderboard panel
+func (app *App) showBoard(board []raceEntry) {
+	title := canvas.NewText("🏁 Race", app.palette.Info)
+	title.TextSize = 18
+	title.TextStyle = fyne.TextStyle{Bold: true}
+	objects := []fyne.CanvasObject{title}
+
+	for i, e := range board {
+		state := fmt.Sprintf("%d/%d", e.Done, e.Total)
+		c := color.Color(app.palette.Input)
+		switch {
+		case e.Finished:
+			state = fmt.Sprintf("🏆 %v", (time.Duration(e.Ms) * time.Millisecond).Round(100*time.Millisecond))
+			c = app.palette.Best
+		case e.Quit:
+			state += " (left)"
+			c = app.palette.Dim
+		}
+		if e.Name == app.race.name {
+			c = app.palette.Success
+		}
+		line := canvas.NewText(fmt.Sprintf("%d. %s  %s", i+1, e.Name, state), c)
+		line.TextSize = 15
+		objects = append(objects, line)
+	}
+
+	app.boardBox.Objects = objects
+	app.boardBox.Show()
+	app.boardBox.Refresh()
+}
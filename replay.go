@@ -0,0 +1,468 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"fyne.io/fyne/v2"
+)
+
+// replaysDir holds one gzipped JSON Lines file per recorded session
+const replaysDir = "replays"
+
+// replayHeader is the first line of a replay file. It carries everything the
+// viewer needs to rebuild the session: the seed fixes pattern order and
+// click cells, the settings fix timing windows.
+type replayHeader struct {
+	Version  int            `json:"v"`
+	Start    time.Time      `json:"start"`
+	Seed     int64          `json:"seed"`
+	Profile  string         `json:"profile"`
+	Mode     Mode           `json:"mode"`
+	Patterns []Pattern      `json:"patterns"`
+	BPM      map[string]int `json:"bpm,omitempty"` // metronome tempo per pattern ID at session start
+	Build    *BuildOrder    `json:"build,omitempty"`
+	Daily    string         `json:"daily,omitempty"` // date of the daily challenge played
+
+	DoubleIntervalMs     int `json:"double_interval_ms"`
+	MetronomeBPM         int `json:"metronome_bpm"`
+	MetronomeToleranceMs int `json:"metronome_tolerance_ms"`
+
+	Interrupts []Interrupt `json:"interrupts,omitempty"`
+
+	// Queue is the session's composed queue, which can depend on stats the
+	// viewer doesn't have
+	Queue   []Pattern `json:"queue,omitempty"`
+	Requeue Requeue   `json:"requeue,omitempty"`
+
+	// Generated patterns: the queue has them, but drawing them moves the rng
+	Source         Source     `json:"source,omitempty"`
+	Templates      []Template `json:"templates,omitempty"`
+	GeneratedCount int        `json:"generated_count,omitempty"`
+	GeneratorSeed  int64      `json:"generator_seed,omitempty"`
+
+	MistakePolicy MistakePolicy `json:"mistake_policy,omitempty"`
+	PenaltyMs     int           `json:"penalty_ms,omitempty"`
+	MemoryFlashMs int           `json:"memory_flash_ms,omitempty"`
+
+	// Adaptive mode: levels and best times per pattern ID at session start,
+	// which decide the variants and targets
+	Adaptive map[string]*AdaptiveStats `json:"adaptive,omitempty"`
+	Best     map[string]time.Duration  `json:"best,omitempty"`
+}
+
+// replayEvent is one recorded input or session step
+type replayEvent struct {
+	T        int64   `json:"t"` // milliseconds since session start
+	Kind     string  `json:"k"` // next, step, raise, expire, key, click, drag, dragmiss, stop, end
+	Key      string  `json:"key,omitempty"`
+	Cell     int     `json:"cell"`           // grid cell for clicks, -1 otherwise
+	Lane     int     `json:"lane,omitempty"` // interrupt lane for raise and expire
+	Coverage float32 `json:"cov,omitempty"`
+	Outcome  string  `json:"out,omitempty"` // ok, half, miss, done; empty if ignored
+}
+
+// recorder streams events of the running session to its replay file
+type recorder struct {
+	file  *os.File
+	gz    *gzip.Writer
+	enc   *json.Encoder
+	start time.Time
+}
+
+// now is the engine's clock; a replay viewer substitutes recorded time
+func (app *App) now() time.Time {
+	if app.clock != nil {
+		return app.clock()
+	}
+	return time.Now()
+}
+
+func (app *App) startRecording(seed int64) {
+	os.MkdirAll(replaysDir, 0755)
+	start := time.Now()
+	path := filepath.Join(replaysDir, start.Format("session-20060102-150405.jsonl.gz"))
+	file, err := os.Create(path)
+	if err != nil {
+		return
+	}
+
+	gz := gzip.NewWriter(file)
+	app.recorder = &recorder{file: file, gz: gz, enc: json.NewEncoder(gz), start: start}
+
+	header := replayHeader{
+		Version:              2,
+		Start:                start,
+		Seed:                 seed,
+		Profile:              app.settings.profileName(),
+		Mode:                 app.mode(),
+		Patterns:             app.sessionPatterns(),
+		BPM:                  make(map[string]int),
+		DoubleIntervalMs:     app.settings.DoubleIntervalMs,
+		MetronomeBPM:         app.settings.MetronomeBPM,
+		MetronomeToleranceMs: app.settings.MetronomeToleranceMs,
+		Interrupts:           app.settings.Interrupts,
+		Queue:                app.patternQueue,
+		Requeue:              app.requeuePolicy(),
+		Source:               app.source(),
+		Templates:            app.templates,
+		GeneratedCount:       app.settings.GeneratedCount,
+		GeneratorSeed:        app.settings.GeneratorSeed,
+		MistakePolicy:        app.mistakePolicy(),
+		PenaltyMs:            app.settings.PenaltyMs,
+		MemoryFlashMs:        app.settings.MemoryFlashMs,
+	}
+	if app.build != nil {
+		header.Build = &app.build.order
+	}
+	if app.daily != nil {
+		header.Daily = app.daily.date
+	}
+	for key, ps := range app.stats.PatternStats {
+		if ps.Rhythm != nil && ps.Rhythm.BPM > 0 {
+			header.BPM[key] = ps.Rhythm.BPM
+		}
+	}
+	if header.Mode == modeAdaptive {
+		header.Adaptive = make(map[string]*AdaptiveStats)
+		header.Best = make(map[string]time.Duration)
+		for key, ps := range app.stats.PatternStats {
+			if ps.Adaptive != nil {
+				adaptive := *ps.Adaptive
+				header.Adaptive[key] = &adaptive
+			}
+			if ps.BestTime > 0 {
+				header.Best[key] = ps.BestTime
+			}
+		}
+	}
+	app.recorder.enc.Encode(header)
+	gz.Flush()
+}
+
+// record appends an event with the outcome of the input just handled. Each
+// event is flushed to the file, so a crash loses at most the one being
+// written.
+func (app *App) record(ev replayEvent) {
+	if app.recorder == nil {
+		return
+	}
+	ev.T = time.Since(app.recorder.start).Milliseconds()
+	ev.Outcome = app.lastOutcome
+	app.recorder.enc.Encode(ev)
+	app.recorder.gz.Flush()
+}
+
+// stopRecording writes the closing event and finishes the file
+func (app *App) stopRecording(kind string) {
+	if app.recorder == nil {
+		return
+	}
+	app.record(replayEvent{Kind: kind, Cell: -1})
+	app.recorder.gz.Close()
+	app.recorder.file.Close()
+	app.recorder = nil
+}
+
+func loadReplay(path string) (replayHeader, []replayEvent, error) {
+	var header replayHeader
+	file, err := os.Open(path)
+	if err != nil {
+		return header, nil, err
+	}
+	defer file.Close()
+
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return header, nil, err
+	}
+	defer gz.Close()
+
+	scanner := bufio.NewScanner(gz)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	if !scanner.Scan() {
+		return header, nil, fmt.Errorf("%s: empty replay", path)
+	}
+	if err := json.Unmarshal(scanner.Bytes(), &header); err != nil {
+		return header, nil, fmt.Errorf("%s: bad header: %w", path, err)
+	}
+
+	var events []replayEvent
+	for scanner.Scan() {
+		var ev replayEvent
+		if err := json.Unmarshal(scanner.Bytes(), &ev); err != nil {
+			// A session cut short by a crash can end mid-line
+			break
+		}
+		events = append(events, ev)
+	}
+	return header, events, nil
+}
+
+// openLatestReplay opens a viewer for the most recent session
+func (app *App) openLatestReplay() {
+	path := latestReplay()
+	if path == "" {
+		app.statusLabel.Text = "No replays recorded yet"
+		app.statusLabel.Color = app.palette.Muted
+		app.statusLabel.Refresh()
+		return
+	}
+
+	w, err := openReplay(fyne.CurrentApp(), path)
+	if err != nil {
+		app.statusLabel.Text = "❌ " + err.Error()
+		app.statusLabel.Color = app.palette.Error
+		app.statusLabel.Refresh()
+		return
+	}
+	w.Show()
+}
+
+// latestReplay returns the newest replay file, or "" if there are none
+func latestReplay() string {
+	paths, _ := filepath.Glob(filepath.Join(replaysDir, "session-*.jsonl.gz"))
+	if len(paths) == 0 {
+		return ""
+	}
+	sort.Strings(paths)
+	return paths[len(paths)-1]
+}
+
+// openReplay builds a viewer window that plays a recorded session back
+// through a private App, so it renders exactly like the live trainer
+func openReplay(a fyne.App, path string) (fyne.Window, error) {
+	header, events, err := loadReplay(path)
+	if err != nil {
+		return nil, err
+	}
+
+	settings := defaultSettings()
+	settings.Profile = header.Profile
+	settings.Mode = header.Mode
+	settings.DoubleIntervalMs = header.DoubleIntervalMs
+	settings.MetronomeBPM = header.MetronomeBPM
+	settings.MetronomeToleranceMs = header.MetronomeToleranceMs
+	settings.Interrupts = header.Interrupts
+	settings.MemoryFlashMs = header.MemoryFlashMs
+	if header.Requeue != "" {
+		settings.Requeue = header.Requeue
+	}
+	if header.Source != "" {
+		settings.Source = header.Source
+		settings.GeneratedCount = header.GeneratedCount
+		settings.GeneratorSeed = header.GeneratorSeed
+	}
+	if header.MistakePolicy != "" {
+		settings.MistakePolicy = header.MistakePolicy
+		settings.PenaltyMs = header.PenaltyMs
+	}
+	settings.Muted = true
+	// The viewer is drawn in the watcher's own theme
+	own := loadSettings()
+	palette, _ := loadPalette(own)
+	settings.Theme = own.Theme
+	settings.TargetTextSize = own.TargetTextSize
+	settings.InputTextSize = own.InputTextSize
+
+	// In-memory stats: a replay must never touch the real stats file
+	stats := &AllStats{PatternStats: make(map[string]*PatternStats)}
+	seed := func(key string) *PatternStats {
+		if _, ok := stats.PatternStats[key]; !ok {
+			stats.PatternStats[key] = &PatternStats{Pattern: key}
+		}
+		return stats.PatternStats[key]
+	}
+	for key, bpm := range header.BPM {
+		seed(key).Rhythm = &RhythmStats{BPM: bpm}
+	}
+	for key, adaptive := range header.Adaptive {
+		seed(key).Adaptive = adaptive
+	}
+	for key, best := range header.Best {
+		seed(key).BestTime = best
+	}
+	// Version 1 keyed tempos by the raw pattern rather than its ID
+	if header.Version >= 2 {
+		stats.Version = statsVersion
+	}
+	stats.migrate(header.Patterns)
+
+	w := a.NewWindow("")
+	w.Resize(fyne.NewSize(700, 450))
+	viewer := &App{
+		window:      w,
+		allPatterns: header.Patterns,
+		templates:   header.Templates,
+		stats:       stats,
+		settings:    settings,
+		palette:     palette,
+		audio:       &Audio{settings: settings},
+		playback:    true,
+	}
+	if header.Daily != "" {
+		viewer.daily = &dailyRun{date: header.Daily}
+	}
+	if header.Build != nil {
+		viewer.buildOrders = []BuildOrder{*header.Build}
+		settings.BuildOrder = header.Build.Name
+	}
+	player := &replayPlayer{
+		app:     viewer,
+		name:    filepath.Base(path),
+		events:  events,
+		speed:   1,
+		control: make(chan rune, 8),
+	}
+	viewer.player = player
+	viewer.clock = func() time.Time { return player.now }
+	viewer.setupUI()
+
+	player.now = header.Start
+	viewer.beginSession(header.Seed)
+	if header.Queue != nil {
+		viewer.patternQueue = header.Queue
+	}
+	viewer.sessionStart = header.Start
+	player.showState()
+	w.SetOnClosed(func() { close(player.control) })
+
+	go player.run(header.Start)
+	return w, nil
+}
+
+// replayPlayer feeds recorded events to a viewer App at 1x, 2x or one step
+// at a time
+type replayPlayer struct {
+	app     *App
+	name    string
+	events  []replayEvent
+	now     time.Time // recorded time of the event being applied
+	speed   float64   // 0 steps one event per SPACE
+	paused  bool
+	played  int
+	control chan rune
+}
+
+func (p *replayPlayer) typedKey(name fyne.KeyName) {
+	switch name {
+	case fyne.KeySpace:
+		p.send(' ')
+	case fyne.KeyEscape:
+		p.app.window.Close()
+	}
+}
+
+func (p *replayPlayer) typedRune(r rune) {
+	switch r {
+	case '1', '2', 's', 'S':
+		p.send(r)
+	}
+}
+
+func (p *replayPlayer) send(r rune) {
+	select {
+	case p.control <- r:
+	default:
+	}
+}
+
+// run waits out the gap before each event and applies it on the UI thread.
+// Only this goroutine changes playback state; the UI reads it while this
+// goroutine is blocked in DoAndWait.
+func (p *replayPlayer) run(start time.Time) {
+	var last int64
+	for i := 0; i < len(p.events); {
+		ev := p.events[i]
+
+		var timer <-chan time.Time
+		if p.speed > 0 && !p.paused {
+			timer = time.After(time.Duration(float64(ev.T-last) * float64(time.Millisecond) / p.speed))
+		}
+
+		advance := false
+		select {
+		case <-timer:
+			advance = true
+		case c, ok := <-p.control:
+			if !ok {
+				return
+			}
+			switch c {
+			case '1':
+				p.speed, p.paused = 1, false
+			case '2':
+				p.speed, p.paused = 2, false
+			case 's', 'S':
+				p.speed = 0
+			case ' ':
+				if p.speed == 0 {
+					advance = true
+				} else {
+					p.paused = !p.paused
+				}
+			}
+		}
+
+		if advance {
+			fyne.DoAndWait(func() {
+				p.now = start.Add(time.Duration(ev.T) * time.Millisecond)
+				p.apply(ev)
+				p.played = i + 1
+			})
+			last = ev.T
+			i++
+		}
+		fyne.DoAndWait(p.showState)
+	}
+}
+
+// apply replays one event through the same entry points live input uses
+func (p *replayPlayer) apply(ev replayEvent) {
+	app := p.app
+	switch ev.Kind {
+	case "next":
+		app.nextPattern()
+	case "step":
+		app.promptBuildStep()
+	case "raise":
+		app.raiseLane(ev.Lane)
+	case "expire":
+		app.expireLane(ev.Lane)
+	case "key":
+		app.pressKey(ev.Key)
+	case "click":
+		app.gridClick(ev.Cell, ev.Key)
+	case "drag":
+		app.scoreDrag(ev.Coverage)
+	case "dragmiss":
+		app.dragMiss()
+	case "stop":
+		app.stopSession()
+	}
+}
+
+func (p *replayPlayer) showState() {
+	state := fmt.Sprintf("%gx", p.speed)
+	switch {
+	case p.speed == 0:
+		state = "step"
+	case p.paused:
+		state = "paused"
+	}
+	p.app.window.SetTitle(fmt.Sprintf("▶ Replay %s • %s • %d/%d events", p.name, state, p.played, len(p.events)))
+
+	if p.played == len(p.events) {
+		p.app.hintLabel.Text = "Replay finished • ESC to close"
+	} else {
+		p.app.hintLabel.Text = "SPACE pause/step • 1 / 2 speed • S step mode • ESC close"
+	}
+	p.app.hintLabel.Color = p.app.palette.Hint
+	p.app.hintLabel.Refresh()
+}
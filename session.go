@@ -0,0 +1,201 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Order is how a session's patterns are arranged
+type Order string
+
+const (
+	orderShuffle Order = "shuffle"
+	orderFile    Order = "file"
+	orderHardest Order = "hardest" // lowest perfect rate first, untried before all
+	orderStale   Order = "stale"   // least recently practised first
+)
+
+// Requeue is what happens to a pattern finished with resets
+type Requeue string
+
+const (
+	requeueLater Requeue = "later" // back of the queue
+	requeueNow   Requeue = "now"   // straight away
+	requeueNever Requeue = "never" // dropped for this session
+)
+
+// Source is where a session's patterns come from
+type Source string
+
+const (
+	sourceFile      Source = "file"      // the patterns file
+	sourceGenerated Source = "generated" // drawn from the templates
+	sourceMixed     Source = "mixed"     // both
+)
+
+var sources = []Source{sourceFile, sourceGenerated, sourceMixed}
+
+var sourceLabels = map[Source]string{
+	sourceFile:      "Patterns file",
+	sourceGenerated: "🎲 Generated",
+	sourceMixed:     "Patterns file + 🎲 Generated",
+}
+
+// composeSession builds the session's queue from the settings. The shuffle
+// always runs, so the rng ends up in the same state whatever the order, and
+// patterns the other orders rank equal come up in random order.
+func (app *App) composeSession() {
+	// The daily challenge is the day's patterns in the order drawn
+	if app.daily != nil {
+		app.patternQueue = app.dailyQueue()
+		app.sessionDropped = 0
+		return
+	}
+
+	size, order := app.settings.SessionSize, app.settings.Order
+	// Everyone in a race plays the same full shuffled queue
+	if app.race != nil {
+		size, order = 0, orderShuffle
+	}
+
+	var patterns []Pattern
+	if app.source() != sourceGenerated {
+		patterns = append(patterns, app.sessionPatterns()...)
+	}
+	if app.source() != sourceFile {
+		patterns = append(patterns, app.generatedPatterns()...)
+	}
+	// With no usable templates there is still the patterns file
+	if len(patterns) == 0 {
+		patterns = app.sessionPatterns()
+	}
+
+	type entry struct {
+		pattern Pattern
+		index   int // position in the patterns file, generated ones after
+	}
+	entries := make([]entry, len(patterns))
+	for i, p := range patterns {
+		entries[i] = entry{p, i}
+	}
+	app.rng.Shuffle(len(entries), func(i, j int) {
+		entries[i], entries[j] = entries[j], entries[i]
+	})
+
+	switch order {
+	case orderFile:
+		sort.SliceStable(entries, func(i, j int) bool { return entries[i].index < entries[j].index })
+	case orderHardest:
+		sort.SliceStable(entries, func(i, j int) bool {
+			return app.stats.difficulty(entries[i].pattern) > app.stats.difficulty(entries[j].pattern)
+		})
+	case orderStale:
+		sort.SliceStable(entries, func(i, j int) bool {
+			return app.stats.lastPracticed(entries[i].pattern).Before(app.stats.lastPracticed(entries[j].pattern))
+		})
+	}
+
+	if size > 0 && size < len(entries) {
+		entries = entries[:size]
+	}
+	app.patternQueue = nil
+	for _, e := range entries {
+		for range app.repeats(e.pattern) {
+			app.patternQueue = append(app.patternQueue, e.pattern)
+		}
+	}
+	app.sessionDropped = 0
+}
+
+// repeats is how many times in a row a pattern comes up: its own count,
+// else its template's, else the global one
+func (app *App) repeats(p Pattern) int {
+	if app.race != nil {
+		return 1
+	}
+	n, ok := app.settings.PatternRepeats[p.key()]
+	if !ok && p.Template != "" {
+		n, ok = app.settings.PatternRepeats[p.Template]
+	}
+	if !ok {
+		n = app.settings.Repeats
+	}
+	return max(n, 1)
+}
+
+// requeue puts a pattern finished with mistakes back in the queue as the
+// settings say, and returns what to tell the player
+func (app *App) requeue(p Pattern) string {
+	// An adaptive variant goes back as the pattern it was made from
+	if app.adaptive != nil {
+		p = app.adaptive.base
+	}
+	switch app.requeuePolicy() {
+	case requeueNow:
+		app.patternQueue = append([]Pattern{p}, app.patternQueue...)
+		return "again now"
+	case requeueNever:
+		app.sessionDropped++
+		return "moving on"
+	}
+	app.patternQueue = append(app.patternQueue, p)
+	return "retry later"
+}
+
+func (app *App) requeuePolicy() Requeue {
+	// A race always brings failed patterns back later
+	if app.race != nil {
+		return requeueLater
+	}
+	// The daily challenge gives each pattern one go
+	if app.daily != nil {
+		return requeueNever
+	}
+	return app.settings.Requeue
+}
+
+func (app *App) source() Source {
+	// A race plays the host's patterns file; templates differ between players
+	if app.race != nil {
+		return sourceFile
+	}
+	if _, ok := sourceLabels[app.settings.Source]; ok {
+		return app.settings.Source
+	}
+	return sourceFile
+}
+
+// cycleSource switches to the next pattern source and remembers it
+func (app *App) cycleSource() {
+	current := app.source()
+	next := sources[0]
+	for i, s := range sources {
+		if s == current {
+			next = sources[(i+1)%len(sources)]
+		}
+	}
+	app.settings.Source = next
+	app.settings.save()
+
+	app.statusLabel.Text = fmt.Sprintf("Patterns: %s", sourceLabels[next])
+	app.statusLabel.Color = app.palette.Info
+	app.statusLabel.Refresh()
+}
+
+// difficulty ranks a pattern for the hardest-first order: the share of
+// attempts that needed resets, with untried patterns above everything
+func (s *AllStats) difficulty(p Pattern) float64 {
+	ps, ok := s.PatternStats[p.key()]
+	if !ok || ps.TotalAttempts == 0 {
+		return 2
+	}
+	return 1 - rate(ps.PerfectCount, ps.TotalAttempts)
+}
+
+func (s *AllStats) lastPracticed(p Pattern) (last time.Time) {
+	if ps, ok := s.PatternStats[p.key()]; ok {
+		last = ps.LastPracticed
+	}
+	return last
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"time"
+)
+
+// settingsFile holds user preferences that are not patterns or stats
+const settingsFile = "keystroke_settings.json"
+
+// Settings holds user-tunable trainer options
+type Settings struct {
+	// DoubleIntervalMs is the longest gap allowed between the two halves
+	// of a double-tap (DT1) or double-click (DLC) token
+	DoubleIntervalMs int `json:"double_interval_ms"`
+
+	// Volume scales feedback sounds from 0 (silent) to 1
+	Volume float64 `json:"volume"`
+	Muted  bool    `json:"muted"`
+
+	// Theme is the palette: dark, light, high-contrast, colorblind, or
+	// custom for the one in keystroke_theme.json. The text sizes are for the
+	// target and the keys typed.
+	Theme          string  `json:"theme"`
+	TargetTextSize float32 `json:"target_text_size"`
+	InputTextSize  float32 `json:"input_text_size"`
+
+	// Mode is the session mode picked on the idle screen
+	Mode Mode `json:"mode"`
+
+	// Session composition: how many patterns a session draws (0 for all),
+	// their order (shuffle, file, hardest, stale), how many times each
+	// comes up in a row, and where a pattern finished with resets goes
+	// (later, now, never). PatternRepeats overrides Repeats for the
+	// patterns or templates with these IDs.
+	SessionSize    int            `json:"session_size"`
+	Order          Order          `json:"order"`
+	Repeats        int            `json:"repeats"`
+	PatternRepeats map[string]int `json:"pattern_repeats"`
+	Requeue        Requeue        `json:"requeue"`
+
+	// Source is where a session's patterns come from: the patterns file
+	// (file), the templates (generated) or both (mixed). GeneratedCount is
+	// how many the templates make, and a GeneratorSeed other than 0 makes
+	// them the same every session.
+	Source         Source `json:"source"`
+	GeneratedCount int    `json:"generated_count"`
+	GeneratorSeed  int64  `json:"generator_seed"`
+
+	// MistakePolicy is what a wrong input costs: reset, checkpoint,
+	// penalty (PenaltyMs added to the time) or backspace
+	MistakePolicy MistakePolicy `json:"mistake_policy"`
+	PenaltyMs     int           `json:"penalty_ms"`
+
+	// MemoryFlashMs is how long memory mode shows a pattern before hiding
+	// it; 0 shows only the name
+	MemoryFlashMs int `json:"memory_flash_ms"`
+
+	// Metronome mode: starting tempo, tempo gain after each clean run, and
+	// how far from the beat a token may land
+	MetronomeBPM         int `json:"metronome_bpm"`
+	MetronomeStep        int `json:"metronome_step"`
+	MetronomeToleranceMs int `json:"metronome_tolerance_ms"`
+
+	// Build-order mode: the build to play, and how long before its time
+	// each step's keys are shown
+	BuildOrder  string `json:"build_order"`
+	BuildLeadMs int    `json:"build_lead_ms"`
+
+	// Multitask mode: interrupt lanes raised on timers beside the main
+	// pattern; the built-in ones are used if this is empty
+	Interrupts []Interrupt `json:"interrupts"`
+
+	// LeaderboardURL is the team leaderboard server new best times are
+	// synced with; empty turns syncing off
+	LeaderboardURL string `json:"leaderboard_url"`
+
+	// PlayerName is who you are on the team leaderboard and in races. The
+	// leaderboard needs one, so teammates' times don't land on each other.
+	PlayerName string `json:"player_name"`
+
+	// Reminder is a time of day like "19:00" for a desktop notification if
+	// the day's share of the minutes goal isn't trained yet, or without
+	// one, if there's been no practice; empty for no reminder
+	Reminder string `json:"reminder"`
+
+	// Profile names the entry in Profiles used for this run
+	Profile  string              `json:"profile"`
+	Profiles map[string]*Profile `json:"profiles"`
+}
+
+// Profile holds per-player input preferences
+type Profile struct {
+	// Layout is one of the built-in keyboard layouts (qwerty, azerty,
+	// qwertz, dvorak)
+	Layout string `json:"layout"`
+	// PositionalLetters also moves letters to the QWERTY key in the same
+	// place, for players who bound their hotkeys by position
+	PositionalLetters bool `json:"positional_letters"`
+	// Weekly goals, 0 for none: minutes trained, and patterns mastered by
+	// finishing them perfectly 5 times in a row
+	GoalMinutes  int `json:"goal_minutes"`
+	GoalMastered int `json:"goal_mastered"`
+	// Remap rewrites an input token to the pattern token it stands for,
+	// applied after the layout, e.g. {"F5": "F1", "h": "a"}
+	Remap map[string]string `json:"remap"`
+}
+
+const defaultProfile = "default"
+
+func defaultSettings() *Settings {
+	return &Settings{
+		DoubleIntervalMs:     300,
+		Volume:               0.6,
+		Theme:                "dark",
+		TargetTextSize:       56,
+		InputTextSize:        56,
+		Mode:                 modeNormal,
+		Order:                orderShuffle,
+		Repeats:              1,
+		Requeue:              requeueLater,
+		Source:               sourceFile,
+		GeneratedCount:       10,
+		MistakePolicy:        policyReset,
+		PenaltyMs:            1000,
+		MemoryFlashMs:        1500,
+		MetronomeBPM:         100,
+		MetronomeStep:        5,
+		MetronomeToleranceMs: 70,
+		BuildLeadMs:          3000,
+		Profile:              defaultProfile,
+		Profiles: map[string]*Profile{
+			defaultProfile: {Layout: "qwerty"},
+		},
+	}
+}
+
+// loadSettings reads the settings file, falling back to defaults for
+// anything missing
+func loadSettings() *Settings {
+	settings := defaultSettings()
+
+	data, err := os.ReadFile(settingsFile)
+	if err != nil {
+		return settings
+	}
+
+	json.Unmarshal(data, settings)
+	return settings
+}
+
+func (s *Settings) save() error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(settingsFile, data, 0644)
+}
+
+func (s *Settings) doubleInterval() time.Duration {
+	if s.DoubleIntervalMs <= 0 {
+		return 300 * time.Millisecond
+	}
+	return time.Duration(s.DoubleIntervalMs) * time.Millisecond
+}
+
+// activeProfile returns the selected profile, or a plain QWERTY profile if
+// the name is unknown
+func (s *Settings) activeProfile() *Profile {
+	if p, ok := s.Profiles[s.Profile]; ok && p != nil {
+		return p
+	}
+	return &Profile{Layout: "qwerty"}
+}
+
+func (s *Settings) targetTextSize() float32 {
+	if s.TargetTextSize <= 0 {
+		return 56
+	}
+	return s.TargetTextSize
+}
+
+func (s *Settings) inputTextSize() float32 {
+	if s.InputTextSize <= 0 {
+		return 56
+	}
+	return s.InputTextSize
+}
+
+func (s *Settings) playerName() string {
+	return strings.TrimSpace(s.PlayerName)
+}
+
+func (s *Settings) profileName() string {
+	if s.Profile == "" {
+		return defaultProfile
+	}
+	return s.Profile
+}
@@ -0,0 +1,332 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"image/color"
+	"os"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/theme"
+)
+
+// themeFile holds the custom theme picked with "theme": "custom"
+const themeFile = "keystroke_theme.json"
+
+// themeColor is a color written "#rrggbb" or "#rrggbbaa" in theme files
+type themeColor color.NRGBA
+
+func (c themeColor) RGBA() (r, g, b, a uint32) {
+	return color.NRGBA(c).RGBA()
+}
+
+func (c themeColor) MarshalJSON() ([]byte, error) {
+	text := fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+	if c.A != 255 {
+		text += fmt.Sprintf("%02x", c.A)
+	}
+	return json.Marshal(text)
+}
+
+func (c *themeColor) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return err
+	}
+	hex := strings.TrimPrefix(text, "#")
+	c.A = 255
+	var err error
+	switch len(hex) {
+	case 6:
+		_, err = fmt.Sscanf(hex, "%02x%02x%02x", &c.R, &c.G, &c.B)
+	case 8:
+		_, err = fmt.Sscanf(hex, "%02x%02x%02x%02x", &c.R, &c.G, &c.B, &c.A)
+	default:
+		err = fmt.Errorf("want #rrggbb or #rrggbbaa")
+	}
+	if err != nil {
+		return fmt.Errorf("color %q: %w", text, err)
+	}
+	return nil
+}
+
+// css is the color written for a style sheet or SVG attribute
+func (c themeColor) css() string {
+	return fmt.Sprintf("rgba(%d,%d,%d,%.2f)", c.R, c.G, c.B, float64(c.A)/255)
+}
+
+// withAlpha is the color made see-through
+func (c themeColor) withAlpha(a uint8) themeColor {
+	c.A = a
+	return c
+}
+
+// Palette is every color the trainer draws with, named for what it means
+// rather than how it looks
+type Palette struct {
+	Light bool `json:"-"` // widgets in the editor and gallery use the light look
+
+	Background themeColor `json:"background"`
+	Panel      themeColor `json:"panel"` // boxes like the key recorder
+	Cell       themeColor `json:"cell"`  // click grid cell waiting for nothing
+	CellText   themeColor `json:"cell_text"`
+	Toast      themeColor `json:"toast"`
+
+	Text     themeColor `json:"text"`
+	Input    themeColor `json:"input"` // keys typed so far
+	Muted    themeColor `json:"muted"`
+	Dim      themeColor `json:"dim"`
+	Hint     themeColor `json:"hint"`
+	Info     themeColor `json:"info"`
+	Progress themeColor `json:"progress"`
+
+	Target  themeColor `json:"target"`
+	Ghost   themeColor `json:"ghost"`
+	Lane    themeColor `json:"lane"`    // raised interrupts
+	Pending themeColor `json:"pending"` // first half of a double token
+
+	Success themeColor `json:"success"`
+	Done    themeColor `json:"done"`    // a finished pattern's input
+	Best    themeColor `json:"best"`    // new bests and trophies
+	Warning themeColor `json:"warning"` // finished with resets
+	Caution themeColor `json:"caution"` // input of a run with resets, mistakes to fix
+	Error   themeColor `json:"error"`
+	Stopped themeColor `json:"stopped"` // a session ended early
+	Ended   themeColor `json:"ended"`
+
+	// Click grid cell for each expected click, and drag targets
+	LeftClick       themeColor `json:"left_click"`
+	RightClick      themeColor `json:"right_click"`
+	MiddleClick     themeColor `json:"middle_click"`
+	ShiftLeftClick  themeColor `json:"shift_left_click"`
+	ShiftRightClick themeColor `json:"shift_right_click"`
+	DoubleLeftClick themeColor `json:"double_left_click"`
+	DragTarget      themeColor `json:"drag_target"`
+}
+
+func rgb(r, g, b uint8) themeColor {
+	return themeColor{r, g, b, 255}
+}
+
+var darkPalette = Palette{
+	Background: rgb(25, 25, 35),
+	Panel:      rgb(40, 40, 55),
+	Cell:       rgb(40, 40, 50),
+	CellText:   rgb(255, 255, 255),
+	Toast:      themeColor{45, 45, 70, 240},
+
+	Text:     rgb(255, 255, 255),
+	Input:    rgb(200, 200, 200),
+	Muted:    rgb(150, 150, 150),
+	Dim:      rgb(100, 100, 100),
+	Hint:     rgb(80, 80, 100),
+	Info:     rgb(100, 180, 255),
+	Progress: rgb(150, 150, 180),
+
+	Target:  rgb(80, 220, 120),
+	Ghost:   themeColor{180, 140, 255, 160},
+	Lane:    rgb(255, 200, 80),
+	Pending: rgb(150, 200, 150),
+
+	Success: rgb(100, 255, 100),
+	Done:    rgb(0, 255, 0),
+	Best:    rgb(255, 215, 0),
+	Warning: rgb(255, 180, 100),
+	Caution: rgb(255, 200, 100),
+	Error:   rgb(255, 100, 100),
+	Stopped: rgb(200, 150, 100),
+	Ended:   rgb(200, 200, 100),
+
+	LeftClick:       rgb(60, 160, 60),
+	RightClick:      rgb(60, 60, 200),
+	MiddleClick:     rgb(160, 60, 160),
+	ShiftLeftClick:  rgb(160, 160, 60),
+	ShiftRightClick: rgb(60, 160, 160),
+	DoubleLeftClick: rgb(60, 200, 100),
+	DragTarget:      rgb(200, 120, 40),
+}
+
+var lightPalette = Palette{
+	Light:      true,
+	Background: rgb(245, 245, 240),
+	Panel:      rgb(230, 230, 235),
+	Cell:       rgb(215, 215, 222),
+	CellText:   rgb(255, 255, 255),
+	Toast:      themeColor{255, 255, 255, 240},
+
+	Text:     rgb(20, 20, 30),
+	Input:    rgb(60, 60, 70),
+	Muted:    rgb(110, 110, 115),
+	Dim:      rgb(150, 150, 155),
+	Hint:     rgb(140, 140, 160),
+	Info:     rgb(20, 100, 200),
+	Progress: rgb(90, 90, 130),
+
+	Target:  rgb(20, 130, 60),
+	Ghost:   themeColor{120, 70, 220, 130},
+	Lane:    rgb(190, 110, 0),
+	Pending: rgb(70, 130, 70),
+
+	Success: rgb(20, 140, 40),
+	Done:    rgb(0, 150, 0),
+	Best:    rgb(180, 130, 0),
+	Warning: rgb(200, 100, 20),
+	Caution: rgb(180, 120, 20),
+	Error:   rgb(200, 30, 30),
+	Stopped: rgb(150, 90, 40),
+	Ended:   rgb(140, 130, 20),
+
+	LeftClick:       rgb(50, 150, 50),
+	RightClick:      rgb(50, 70, 200),
+	MiddleClick:     rgb(150, 50, 150),
+	ShiftLeftClick:  rgb(150, 140, 30),
+	ShiftRightClick: rgb(30, 140, 150),
+	DoubleLeftClick: rgb(30, 170, 90),
+	DragTarget:      rgb(210, 120, 30),
+}
+
+// highContrastPalette is pure colors on black for low vision
+var highContrastPalette = Palette{
+	Background: rgb(0, 0, 0),
+	Panel:      rgb(0, 0, 0),
+	Cell:       rgb(40, 40, 40),
+	CellText:   rgb(255, 255, 255),
+	Toast:      rgb(0, 0, 0),
+
+	Text:     rgb(255, 255, 255),
+	Input:    rgb(255, 255, 255),
+	Muted:    rgb(220, 220, 220),
+	Dim:      rgb(180, 180, 180),
+	Hint:     rgb(200, 200, 200),
+	Info:     rgb(0, 255, 255),
+	Progress: rgb(255, 255, 255),
+
+	Target:  rgb(255, 255, 0),
+	Ghost:   themeColor{255, 0, 255, 200},
+	Lane:    rgb(255, 160, 0),
+	Pending: rgb(0, 255, 255),
+
+	Success: rgb(0, 255, 0),
+	Done:    rgb(0, 255, 0),
+	Best:    rgb(255, 255, 0),
+	Warning: rgb(255, 160, 0),
+	Caution: rgb(255, 160, 0),
+	Error:   rgb(255, 50, 50),
+	Stopped: rgb(255, 160, 0),
+	Ended:   rgb(255, 255, 0),
+
+	LeftClick:       rgb(0, 170, 0),
+	RightClick:      rgb(0, 0, 255),
+	MiddleClick:     rgb(200, 0, 200),
+	ShiftLeftClick:  rgb(170, 170, 0),
+	ShiftRightClick: rgb(0, 170, 170),
+	DoubleLeftClick: rgb(0, 120, 60),
+	DragTarget:      rgb(255, 120, 0),
+}
+
+// colorblindPalette keeps to the Okabe-Ito colors, which stay apart for
+// every kind of color blindness: blue for right, vermillion for wrong
+var colorblindPalette = Palette{
+	Background: rgb(25, 25, 35),
+	Panel:      rgb(40, 40, 55),
+	Cell:       rgb(40, 40, 50),
+	CellText:   rgb(255, 255, 255),
+	Toast:      themeColor{45, 45, 70, 240},
+
+	Text:     rgb(255, 255, 255),
+	Input:    rgb(200, 200, 200),
+	Muted:    rgb(150, 150, 150),
+	Dim:      rgb(100, 100, 100),
+	Hint:     rgb(80, 80, 100),
+	Info:     rgb(86, 180, 233),
+	Progress: rgb(150, 150, 180),
+
+	Target:  rgb(240, 228, 66),
+	Ghost:   themeColor{204, 121, 167, 170},
+	Lane:    rgb(230, 159, 0),
+	Pending: rgb(120, 200, 240),
+
+	Success: rgb(86, 180, 233),
+	Done:    rgb(86, 180, 233),
+	Best:    rgb(240, 228, 66),
+	Warning: rgb(230, 159, 0),
+	Caution: rgb(230, 159, 0),
+	Error:   rgb(213, 94, 0),
+	Stopped: rgb(230, 159, 0),
+	Ended:   rgb(240, 228, 66),
+
+	LeftClick:       rgb(0, 114, 178),
+	RightClick:      rgb(213, 94, 0),
+	MiddleClick:     rgb(204, 121, 167),
+	ShiftLeftClick:  rgb(0, 158, 115),
+	ShiftRightClick: rgb(230, 159, 0),
+	DoubleLeftClick: rgb(86, 180, 233),
+	DragTarget:      rgb(240, 228, 66),
+}
+
+var palettes = map[string]Palette{
+	"dark":          darkPalette,
+	"light":         lightPalette,
+	"high-contrast": highContrastPalette,
+	"colorblind":    colorblindPalette,
+}
+
+// customTheme is the theme file: a built-in palette to start from, and
+// the colors that differ from it
+type customTheme struct {
+	Base   string          `json:"base"`
+	Colors json.RawMessage `json:"colors"`
+}
+
+// loadPalette returns the palette the settings pick. A custom theme that
+// can't be read falls back to dark, with the reason.
+func loadPalette(s *Settings) (*Palette, error) {
+	if s.Theme != "custom" {
+		p, ok := palettes[s.Theme]
+		if !ok {
+			p = darkPalette
+		}
+		return &p, nil
+	}
+
+	p := darkPalette
+	data, err := os.ReadFile(themeFile)
+	if err != nil {
+		return &p, err
+	}
+	var custom customTheme
+	if err := json.Unmarshal(data, &custom); err != nil {
+		return &p, fmt.Errorf("%s: %w", themeFile, err)
+	}
+	if base, ok := palettes[custom.Base]; ok {
+		p = base
+	} else if custom.Base != "" {
+		return &p, fmt.Errorf("%s: unknown base %q", themeFile, custom.Base)
+	}
+	if custom.Colors != nil {
+		if err := json.Unmarshal(custom.Colors, &p); err != nil {
+			return &p, fmt.Errorf("%s: %w", themeFile, err)
+		}
+	}
+	return &p, nil
+}
+
+// fyneTheme is Fyne's own theme in the palette's light or dark look, for
+// the widgets in the editor and gallery windows
+type fyneTheme struct {
+	fyne.Theme
+	variant fyne.ThemeVariant
+}
+
+func (p *Palette) fyneTheme() fyne.Theme {
+	variant := theme.VariantDark
+	if p.Light {
+		variant = theme.VariantLight
+	}
+	return &fyneTheme{theme.DefaultTheme(), variant}
+}
+
+func (t *fyneTheme) Color(name fyne.ThemeColorName, _ fyne.ThemeVariant) color.Color {
+	return t.Theme.Color(name, t.variant)
+}